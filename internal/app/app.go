@@ -1,36 +1,95 @@
 package app
 
 import (
+	"fmt"
 	"hson-server/internal/datatree"
 	"hson-server/internal/logger"
+	"hson-server/internal/schema"
+	"hson-server/internal/storage"
+	"hson-server/internal/utils"
 	"net/url"
-	"os"
+	"reflect"
 	"sync"
 	"sync/atomic"
-
-	"github.com/hjson/hjson-go"
+	"time"
 )
 
+// App serves reads from immutable snapshots of the data tree. Writers serialize on Mutex, apply
+// their change to a copy and publish it with an atomic swap, so a published tree is never
+// modified again and readers need no lock.
 type App struct {
-	Mutex       sync.RWMutex
-	Data        map[string]any
-	FilePath    string
-	SelfWriting uint32
+	Mutex sync.Mutex
+
+	// data points at the current snapshot of the data tree
+	data atomic.Pointer[map[string]any]
+
+	// Backend persists the data tree, e.g. a HJSON file, memory only or a bolt database
+	Backend storage.Backend
+
+	// Schemas maps collection paths to JSON Schemas (from --schema), extended by the data's $schema section
+	Schemas map[string]any
+
+	// validator checks writes against Schemas, rebuilt whenever the $schema section changes
+	validator *schema.Validator
+
+	// history records the changes made through the API so they can be undone
+	history history
+
+	// initial is the data as loaded from the storage backend, restored by Reset
+	initial map[string]any
+
+	// snapshots are the named snapshots of the data tree saved through the API
+	snapshots map[string]namedSnapshot
 }
 
 func (app *App) LoadDataFromFile() error {
-	// Get raw data from the hson / data file
-	raw, err := os.ReadFile(app.FilePath)
+	// Add a lock to app data, before loading so no write lands between the load and the swap
+	app.Mutex.Lock()
+
+	// Defer the unlock of lock on function return
+	defer app.Mutex.Unlock()
+
+	// Get the data tree from the storage backend
+	data, err := app.Backend.Load()
+
+	if err != nil {
+		return err
+	}
+
+	// Refuse data that doesn't match its schema, so broken fixtures are caught up front
+	validator, err := schema.FromData(data, app.Schemas)
 
 	if err != nil {
 		return err
 	}
 
-	// Init a var we will use to store structured manner
-	var data map[string]any
+	if err := validator.Validate(data, "/"); err != nil {
+		return err
+	}
+
+	// Publish the loaded data as the current snapshot, changes made before can't be undone anymore
+	app.validator = validator
+	app.data.Store(&data)
+	app.history.reset()
 
-	// Convert raw data to structured data
-	if err := hjson.Unmarshal(raw, &data); err != nil {
+	// Remember the loaded data to reset to, published trees are never modified so it needs no copy
+	app.initial = data
+
+	return nil
+}
+
+// ReloadFile reloads the data after an external edit to file, swapping in only the part of the
+// data tree that file backs when the storage backend supports it
+func (app *App) ReloadFile(file string) error {
+	reloader, ok := app.Backend.(storage.FileReloader)
+
+	if !ok {
+		return app.LoadDataFromFile()
+	}
+
+	treePath, value, err := reloader.ReloadFile(file)
+
+	if err != nil {
 		return err
 	}
 
@@ -40,106 +99,241 @@ func (app *App) LoadDataFromFile() error {
 	// Defer the unlock of lock on function return
 	defer app.Mutex.Unlock()
 
-	// Assign new data to app data
-	app.Data = data
+	// Swap the reloaded value into a copy of the containers above it
+	prev := app.Snapshot()
+	next := datatree.CopyPath(prev, treePath, false)
+
+	if err := datatree.Set(next, treePath, value); err != nil {
+		return err
+	}
+
+	// Keep serving the previous data if the edited file doesn't match the schema. An edit to the
+	// $schema section changes the rules themselves, so the whole tree is checked again.
+	validator, err := schema.FromData(next, app.Schemas)
+
+	if err != nil {
+		return err
+	}
+
+	changedPath := treePath
+
+	if !reflect.DeepEqual(prev[schema.SectionKey], next[schema.SectionKey]) {
+		changedPath = "/"
+	}
+
+	if err := validator.Validate(next, changedPath); err != nil {
+		return err
+	}
+
+	// External edits aren't part of the history, so undoing past them would lose them
+	app.validator = validator
+	app.data.Store(&next)
+	app.history.reset()
+
+	// Resets return to the edited file from now on
+	if app.initial != nil {
+		if initial := datatree.CopyPath(app.initial, treePath, false); datatree.Set(initial, treePath, value) == nil {
+			app.initial = initial
+		}
+	}
+
+	return nil
+}
+
+// Close flushes pending changes (e.g. journal compaction) and releases the storage backend
+func (app *App) Close() error {
+	// Add a lock to app data
+	app.Mutex.Lock()
+
+	// Defer the unlock of lock on function return
+	defer app.Mutex.Unlock()
+
+	return app.Backend.Close()
+}
+
+// Snapshot returns the current data tree. It must be treated as read only, writers publish a
+// new tree instead of changing it.
+func (app *App) Snapshot() map[string]any {
+	if data := app.data.Load(); data != nil {
+		return *data
+	}
 
 	return nil
 }
 
 func (app *App) Read(path string) (any, error) {
+	// Look up the value from the current snapshot, without blocking or being blocked by writers
+	return datatree.Lookup(app.Snapshot(), path)
+}
+
+func (app *App) Write(path string, newVal any, ifMatch string) error {
+	return app.mutate(&datatree.Operation{Verb: datatree.OpSet, Path: path, Value: newVal, IfMatch: ifMatch})
+}
+
+// Append adds an item to the array at path and returns the key (id or index) of the new element
+func (app *App) Append(path string, item any) (string, error) {
+	op := &datatree.Operation{Verb: datatree.OpAppend, Path: path, Value: item}
+
+	if err := app.mutate(op); err != nil {
+		return "", err
+	}
+
+	return op.Key, nil
+}
+
+func (app *App) Patch(path string, patchData map[string]any, ifMatch string) error {
+	return app.mutate(&datatree.Operation{Verb: datatree.OpPatch, Path: path, Value: patchData, IfMatch: ifMatch})
+}
+
+// JSONPatch applies an RFC 6902 operation list to the value at path, all operations or none
+func (app *App) JSONPatch(path string, ops []any, ifMatch string) error {
+	return app.mutate(&datatree.Operation{Verb: datatree.OpJSONPatch, Path: path, Value: ops, IfMatch: ifMatch})
+}
+
+// MergePatch deep merges an RFC 7396 merge patch into the value at path
+func (app *App) MergePatch(path string, patch any, ifMatch string) error {
+	return app.mutate(&datatree.Operation{Verb: datatree.OpMergePatch, Path: path, Value: patch, IfMatch: ifMatch})
+}
+
+func (app *App) Delete(path string, q url.Values, ifMatch string) error {
+	return app.mutate(&datatree.Operation{Verb: datatree.OpDelete, Path: path, Filters: q, IfMatch: ifMatch})
+}
+
+// History lists the changes that can be undone and those that can be redone, newest first
+func (app *App) History() (undo, redo []datatree.Operation) {
 	// Add a lock to app data
-	app.Mutex.RLock()
+	app.Mutex.Lock()
 
 	// Defer the unlock of lock on function return
-	defer app.Mutex.RUnlock()
+	defer app.Mutex.Unlock()
 
-	// Look up the value from app data at the specified path
-	return datatree.Lookup(app.Data, path)
+	return operations(app.history.undo), operations(app.history.redo)
 }
 
-func (app *App) Write(path string, newVal any) error {
+// Undo reverts the latest change by restoring the subtree it touched, and returns its operation
+func (app *App) Undo() (datatree.Operation, error) {
 	// Add a lock to app data
 	app.Mutex.Lock()
 
 	// Defer the unlock of lock on function return
 	defer app.Mutex.Unlock()
 
-	// Set value at the specified path within app data
-	if err := datatree.Set(app.Data, path, newVal); err != nil {
-		return err
+	if len(app.history.undo) == 0 {
+		return datatree.Operation{}, utils.ErrNothingToUndo
 	}
 
-	// Persist updated data back to data file / disk
-	if err := app.persist(); err != nil {
-		logger.Error("failed to write file", "err", err)
-		return err
+	last := app.history.undo[len(app.history.undo)-1]
+
+	// Restoring goes through the usual write path, so it is validated and persisted like any write
+	if err := app.apply(&datatree.Operation{Verb: datatree.OpSet, Path: last.scope, Value: datatree.Clone(last.before)}); err != nil {
+		return datatree.Operation{}, err
 	}
 
-	// Return nil on successful write of data
-	return nil
+	app.history.undo = app.history.undo[:len(app.history.undo)-1]
+	app.history.redo = append(app.history.redo, last)
+
+	return last.op, nil
 }
 
-func (app *App) Patch(path string, patchData map[string]any) error {
+// Redo applies the latest undone change again, and returns its operation
+func (app *App) Redo() (datatree.Operation, error) {
 	// Add a lock to app data
 	app.Mutex.Lock()
 
 	// Defer the unlock of lock on function return
 	defer app.Mutex.Unlock()
 
-	// Apply the patch to the value at the specified path in the data tree
-	if err := datatree.Patch(app.Data, path, patchData); err != nil {
-		return err
+	if len(app.history.redo) == 0 {
+		return datatree.Operation{}, utils.ErrNothingToRedo
 	}
 
-	// Persist updated data back to data file / disk
-	if err := app.persist(); err != nil {
-		logger.Error("failed to write file", "err", err)
-		return err
+	last := app.history.redo[len(app.history.redo)-1]
+
+	if err := app.apply(&datatree.Operation{Verb: datatree.OpSet, Path: last.scope, Value: datatree.Clone(last.after)}); err != nil {
+		return datatree.Operation{}, err
 	}
 
-	// Return nil on successful patch of data
-	return nil
+	app.history.redo = app.history.redo[:len(app.history.redo)-1]
+	app.history.undo = append(app.history.undo, last)
+
+	return last.op, nil
 }
 
-func (app *App) Delete(path string, q url.Values) error {
+// mutate applies an operation made through the API
+func (app *App) mutate(op *datatree.Operation) error {
 	// Add a lock to app data
 	app.Mutex.Lock()
 
 	// Defer the unlock of lock on function return
 	defer app.Mutex.Unlock()
 
-	// If filters / query params are provided, fire bulk delete
-	if len(q) > 0 {
-		filters := datatree.FlattenFilters(q)
+	return app.commit(op)
+}
 
-		if err := datatree.BulkDelete(app.Data, path, filters); err != nil {
-			return err
-		}
-	} else {
-		// Single delete on path when no filter is provided
-		if err := datatree.Delete(app.Data, path); err != nil {
-			return err
-		}
+// commit applies an operation and records it in the history. The caller must hold app.Mutex.
+func (app *App) commit(op *datatree.Operation) error {
+	prev := app.Snapshot()
+
+	if err := app.apply(op); err != nil {
+		return err
 	}
 
-	// Persist change back to hson file
-	return app.persist()
+	app.history.record(*op, prev, app.Snapshot())
+
+	return nil
 }
 
-func (app *App) persist() error {
-	// Set value of self writing to 1 / true
-	atomic.StoreUint32(&app.SelfWriting, 1)
+// apply applies an operation to a copy of the data tree and only publishes it as the new snapshot
+// once the change has been persisted, so memory and disk never diverge on failure.
+// The caller must hold app.Mutex.
+func (app *App) apply(op *datatree.Operation) error {
+	op.Time = time.Now()
 
-	// Inevitably, revert the value of self writing back to 0 / false
-	defer atomic.StoreUint32(&app.SelfWriting, 0)
+	// Conditional requests only go ahead if the resource still matches the client's ETag
+	if op.IfMatch != "" {
+		current, err := datatree.Lookup(app.Snapshot(), op.Path)
 
-	// Convert app data to HJSON encoded data
-	hsonBytes, err := hjson.Marshal(app.Data)
+		if err != nil || !datatree.MatchETag(op.IfMatch, datatree.ETag(current), false) {
+			return utils.ErrPrecondition
+		}
+	}
 
-	if err != nil {
+	// Work on a copy so a failed change leaves app data untouched. Only the containers the
+	// operation changes are copied, the rest is shared with the published snapshot.
+	next := op.Writable(app.Snapshot())
+
+	// Apply the operation to the copied data tree
+	if err := op.Apply(next); err != nil {
 		return err
 	}
 
-	// Write encoded data back to file at app.FilePath
-	return os.WriteFile(app.FilePath, hsonBytes, 0o644)
+	// Writes to the $schema section change the rules themselves, so the whole tree is checked again
+	validator, changedPath := app.validator, op.Path
+
+	if parts := datatree.SplitPath(op.Path); len(parts) == 0 || parts[0] == schema.SectionKey {
+		var err error
+
+		if validator, err = schema.FromData(next, app.Schemas); err != nil {
+			return err
+		}
+
+		changedPath = "/"
+	}
+
+	// Reject the change before persisting it if it breaks a collection's schema
+	if err := validator.Validate(next, changedPath); err != nil {
+		return err
+	}
+
+	// Persist the change through the storage backend
+	if err := app.Backend.Save(next, *op); err != nil {
+		logger.Error("failed to persist change, rolled back in-memory change", "verb", op.Verb, "path", op.Path, "err", err)
+		return fmt.Errorf("%w: %w", utils.ErrPersist, err)
+	}
+
+	// Publish the new data tree now that it is safely persisted
+	app.validator = validator
+	app.data.Store(&next)
+
+	return nil
 }
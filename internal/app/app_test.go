@@ -0,0 +1,129 @@
+package app
+
+import (
+	"errors"
+	"hson-server/internal/schema"
+	"hson-server/internal/storage"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestApp loads the seed data from memory, as --store=memory does
+func newTestApp(t *testing.T, seed string) *App {
+	t.Helper()
+
+	app, err := loadTestApp(t, seed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return app
+}
+
+func loadTestApp(t *testing.T, seed string) (*App, error) {
+	seedPath := filepath.Join(t.TempDir(), "data.hson")
+
+	if err := os.WriteFile(seedPath, []byte(seed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{Backend: storage.NewMemory(seedPath)}
+
+	return app, app.LoadDataFromFile()
+}
+
+const seedUsers = `{
+  users: [{id: 1, name: "Ann", age: 30}]
+  $schema: {
+    users: {type: "object", required: ["name"], properties: {age: {type: "integer", minimum: 0}}}
+  }
+}
+`
+
+func TestSchemaRejectsWrites(t *testing.T) {
+	app := newTestApp(t, seedUsers)
+	users, _ := app.Read("/users")
+
+	if _, err := app.Append("/users", map[string]any{"name": "Bob", "age": float64(-1)}); !errors.Is(err, schema.ErrInvalid) {
+		t.Fatalf("got %v, want %v", err, schema.ErrInvalid)
+	}
+
+	if err := app.Patch("/users/1", map[string]any{"age": "old"}, ""); !errors.Is(err, schema.ErrInvalid) {
+		t.Fatalf("got %v, want %v", err, schema.ErrInvalid)
+	}
+
+	// Schemas that the current data breaks are refused as well
+	if err := app.Write("/$schema/users/required", []any{"email"}, ""); !errors.Is(err, schema.ErrInvalid) {
+		t.Fatalf("got %v, want %v", err, schema.ErrInvalid)
+	}
+
+	if got, _ := app.Read("/users"); !reflect.DeepEqual(got, users) {
+		t.Fatalf("rejected writes changed the users to %v", got)
+	}
+
+	if _, err := app.Append("/users", map[string]any{"name": "Bob"}); err != nil {
+		t.Fatalf("got %v for a valid user", err)
+	}
+}
+
+func TestSchemaRejectsInvalidSeed(t *testing.T) {
+	if _, err := loadTestApp(t, `{users: [{id: 1}], $schema: {users: {required: ["name"]}}}`); !errors.Is(err, schema.ErrInvalid) {
+		t.Fatalf("got %v, want %v", err, schema.ErrInvalid)
+	}
+}
+
+// TestReloadSchemaFile checks that an edited $schema file is checked against the whole tree
+func TestReloadSchemaFile(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "$schema.hson")
+
+	files := map[string]string{
+		"users.hson":   `[{id: 1, name: "Ann"}]`,
+		"$schema.hson": `{users: {type: "object", required: ["name"]}}`,
+	}
+
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := &App{Backend: storage.NewDir(dir)}
+
+	if err := app.LoadDataFromFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The users don't have the newly required email, so the edit is refused
+	if err := os.WriteFile(schemaPath, []byte(`{users: {type: "object", required: ["email"]}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.ReloadFile(schemaPath); !errors.Is(err, schema.ErrInvalid) {
+		t.Fatalf("got %v, want %v", err, schema.ErrInvalid)
+	}
+
+	if _, err := app.Append("/users", map[string]any{"name": "Bob"}); err != nil {
+		t.Fatalf("got %v, the refused schema is in use", err)
+	}
+
+	// Schemas the users match are swapped in
+	if err := os.WriteFile(schemaPath, []byte(`{users: {type: "object", required: ["id"]}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.ReloadFile(schemaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.Append("/users", map[string]any{"name": "Cid"}); err != nil {
+		t.Fatalf("got %v for a user with a generated id", err)
+	}
+
+	if err := app.Write("/users/1", map[string]any{"name": "Ann"}, ""); !errors.Is(err, schema.ErrInvalid) {
+		t.Fatalf("got %v, want %v", err, schema.ErrInvalid)
+	}
+}
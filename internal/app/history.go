@@ -0,0 +1,82 @@
+package app
+
+import (
+	"flag"
+	"hson-server/internal/datatree"
+	"slices"
+	"strings"
+)
+
+// HistoryDepth caps how many changes can be undone, 0 disables the history
+var HistoryDepth = 50
+
+func RegisterFlags() {
+	flag.IntVar(&HistoryDepth, "history-depth", 50, "number of changes kept for /__admin/undo and /__admin/redo (0 disables the history)")
+}
+
+// change is a mutation in the history along with the subtree it touched, before and after. Both
+// values belong to published snapshots, which are never modified, so they can be kept as is.
+type change struct {
+	op     datatree.Operation
+	scope  string
+	before any
+	after  any
+}
+
+// history holds the changes that can be undone, newest last, and those undone since the last write
+type history struct {
+	undo []change
+	redo []change
+}
+
+// record adds a change that turned the prev snapshot into next, dropping the oldest changes
+// beyond HistoryDepth. A new change makes the undone ones impossible to redo.
+func (h *history) record(op datatree.Operation, prev, next map[string]any) {
+	if HistoryDepth <= 0 {
+		return
+	}
+
+	// The scope is the closest path, from the operation's path up, addressing the same element
+	// before and after the change, e.g: deleting /books/3 or changing its id is undone by restoring
+	// /books, since /books/3 would fall back to another element by index afterwards
+	parts := datatree.SplitPath(op.Path)
+
+	for len(parts) > 0 {
+		path := strings.Join(parts, "/")
+		before, beforeErr := datatree.Positions(prev, path)
+		after, afterErr := datatree.Positions(next, path)
+
+		if beforeErr == nil && afterErr == nil && slices.Equal(before, after) {
+			break
+		}
+
+		parts = parts[:len(parts)-1]
+	}
+
+	scope := "/" + strings.Join(parts, "/")
+	before, _ := datatree.Lookup(prev, scope)
+	after, _ := datatree.Lookup(next, scope)
+
+	h.undo = append(h.undo, change{op: op, scope: scope, before: before, after: after})
+	h.redo = nil
+
+	if overflow := len(h.undo) - HistoryDepth; overflow > 0 {
+		h.undo = slices.Delete(h.undo, 0, overflow)
+	}
+}
+
+// reset forgets every change, e.g: after the data was replaced from outside
+func (h *history) reset() {
+	h.undo, h.redo = nil, nil
+}
+
+// operations lists the operations of changes, newest first
+func operations(changes []change) []datatree.Operation {
+	ops := make([]datatree.Operation, 0, len(changes))
+
+	for i := len(changes) - 1; i >= 0; i-- {
+		ops = append(ops, changes[i].op)
+	}
+
+	return ops
+}
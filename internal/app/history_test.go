@@ -0,0 +1,129 @@
+package app
+
+import (
+	"errors"
+	"hson-server/internal/utils"
+	"reflect"
+	"testing"
+)
+
+func TestUndoRedo(t *testing.T) {
+	app := newTestApp(t, "{books: [{id: 1, title: \"Dune\"}, {id: 2, title: \"Emma\"}]}\n")
+	seeded, _ := app.Read("/")
+
+	if err := app.Patch("/books/1", map[string]any{"title": "Dune Messiah"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Delete("/books/2", nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	edited, _ := app.Read("/")
+
+	// Changes are undone newest first
+	for range 2 {
+		if _, err := app.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, _ := app.Read("/"); !reflect.DeepEqual(got, seeded) {
+		t.Fatalf("undid to %v, want %v", got, seeded)
+	}
+
+	if _, err := app.Undo(); !errors.Is(err, utils.ErrNothingToUndo) {
+		t.Fatalf("got %v, want %v", err, utils.ErrNothingToUndo)
+	}
+
+	for range 2 {
+		if _, err := app.Redo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, _ := app.Read("/"); !reflect.DeepEqual(got, edited) {
+		t.Fatalf("redid to %v, want %v", got, edited)
+	}
+
+	// A new change can't be followed by a redo
+	app.Undo()
+
+	if _, err := app.Append("/books", map[string]any{"title": "Emma"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.Redo(); !errors.Is(err, utils.ErrNothingToRedo) {
+		t.Fatalf("got %v, want %v", err, utils.ErrNothingToRedo)
+	}
+}
+
+func TestHistoryDepth(t *testing.T) {
+	defer func(depth int) { HistoryDepth = depth }(HistoryDepth)
+	HistoryDepth = 2
+
+	app := newTestApp(t, "{n: 0}\n")
+
+	for n := 1; n <= 3; n++ {
+		if err := app.Write("/n", float64(n), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if undo, _ := app.History(); len(undo) != 2 {
+		t.Fatalf("kept %d changes, want 2", len(undo))
+	}
+
+	app.Undo()
+	app.Undo()
+
+	if n, _ := app.Read("/n"); n != float64(1) {
+		t.Fatalf("undid to %v, want the oldest kept change to remain", n)
+	}
+}
+
+// TestUndoKeyChange changes the id of an item, after which its old URL falls back to another item
+// by index, undo and redo must only touch the changed item
+func TestUndoKeyChange(t *testing.T) {
+	app := newTestApp(t, "{books: [{id: 1}, {id: 2, title: \"Dune\"}, {id: 3}, {id: 4}]}\n")
+
+	writes := map[string]func() error{
+		"PATCH": func() error { return app.Patch("/books/2", map[string]any{"id": float64(10)}, "") },
+		"PUT":   func() error { return app.Write("/books/2", map[string]any{"id": float64(10), "title": "Dune"}, "") },
+		"merge patch": func() error {
+			return app.MergePatch("/books/2", map[string]any{"id": float64(10)}, "")
+		},
+		"JSON patch": func() error {
+			return app.JSONPatch("/books/2", []any{map[string]any{"op": "replace", "path": "/id", "value": float64(10)}}, "")
+		},
+		"DELETE": func() error { return app.Delete("/books/2", nil, "") },
+	}
+
+	for name, write := range writes {
+		seeded, _ := app.Read("/")
+
+		if err := write(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		edited, _ := app.Read("/")
+
+		if _, err := app.Undo(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if got, _ := app.Read("/"); !reflect.DeepEqual(got, seeded) {
+			t.Fatalf("%s: undid to %v, want %v", name, got, seeded)
+		}
+
+		if _, err := app.Redo(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if got, _ := app.Read("/"); !reflect.DeepEqual(got, edited) {
+			t.Fatalf("%s: redid to %v, want %v", name, got, edited)
+		}
+
+		app.Undo()
+	}
+}
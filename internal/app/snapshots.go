@@ -0,0 +1,118 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"hson-server/internal/datatree"
+	"hson-server/internal/utils"
+	"time"
+)
+
+// namedSnapshot is a data tree saved under a name. It shares the published tree it was taken
+// from, which is never modified.
+type namedSnapshot struct {
+	data  map[string]any
+	saved time.Time
+}
+
+// SaveSnapshot saves the current data tree under name, replacing any snapshot of that name
+func (app *App) SaveSnapshot(name string) error {
+	// Add a lock to app data
+	app.Mutex.Lock()
+
+	// Defer the unlock of lock on function return
+	defer app.Mutex.Unlock()
+
+	if app.snapshots == nil {
+		app.snapshots = map[string]namedSnapshot{}
+	}
+
+	app.snapshots[name] = namedSnapshot{data: app.Snapshot(), saved: time.Now()}
+
+	return nil
+}
+
+// NamedSnapshots returns the names of the saved snapshots along with when they were saved
+func (app *App) NamedSnapshots() map[string]time.Time {
+	// Add a lock to app data
+	app.Mutex.Lock()
+
+	// Defer the unlock of lock on function return
+	defer app.Mutex.Unlock()
+
+	names := make(map[string]time.Time, len(app.snapshots))
+
+	for name, snapshot := range app.snapshots {
+		names[name] = snapshot.saved
+	}
+
+	return names
+}
+
+// DeleteSnapshot forgets the snapshot saved under name
+func (app *App) DeleteSnapshot(name string) error {
+	// Add a lock to app data
+	app.Mutex.Lock()
+
+	// Defer the unlock of lock on function return
+	defer app.Mutex.Unlock()
+
+	if _, ok := app.snapshots[name]; !ok {
+		return fmt.Errorf("%w: %q", utils.ErrSnapshotNotFound, name)
+	}
+
+	delete(app.snapshots, name)
+
+	return nil
+}
+
+// RestoreSnapshot brings back the value at path ("/" for everything) as it was in the snapshot
+// saved under name
+func (app *App) RestoreSnapshot(name, path string) error {
+	// Add a lock to app data
+	app.Mutex.Lock()
+
+	// Defer the unlock of lock on function return
+	defer app.Mutex.Unlock()
+
+	snapshot, ok := app.snapshots[name]
+
+	if !ok {
+		return fmt.Errorf("%w: %q", utils.ErrSnapshotNotFound, name)
+	}
+
+	return app.restore(snapshot.data, path)
+}
+
+// Reset brings back the value at path ("/" for everything) as it was loaded from the storage backend
+func (app *App) Reset(path string) error {
+	// Add a lock to app data
+	app.Mutex.Lock()
+
+	// Defer the unlock of lock on function return
+	defer app.Mutex.Unlock()
+
+	return app.restore(app.initial, path)
+}
+
+// restore sets the value at path to its value in tree, as a single change that can be undone.
+// A path missing from tree is removed. The caller must hold app.Mutex.
+func (app *App) restore(tree map[string]any, path string) error {
+	value, err := datatree.Lookup(tree, path)
+
+	if errors.Is(err, datatree.ErrNotFound) {
+		// Nothing to remove if the path was never added since
+		if _, err := datatree.Lookup(app.Snapshot(), path); err != nil {
+			return nil
+		}
+
+		return app.commit(&datatree.Operation{Verb: datatree.OpRemove, Path: path})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Restoring goes through the usual write path, so it is validated and persisted like any write
+	return app.commit(&datatree.Operation{Verb: datatree.OpSet, Path: path, Value: datatree.Clone(value)})
+}
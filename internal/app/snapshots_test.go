@@ -0,0 +1,125 @@
+package app
+
+import (
+	"errors"
+	"hson-server/internal/datatree"
+	"hson-server/internal/utils"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshots(t *testing.T) {
+	app := newTestApp(t, "{books: [{id: 1}], authors: [{id: 1}]}\n")
+	seeded, _ := app.Read("/")
+
+	if err := app.SaveSnapshot("seeded"); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Append("/books", map[string]any{})
+	app.Append("/authors", map[string]any{})
+
+	// A scoped restore leaves the rest of the data alone
+	if err := app.RestoreSnapshot("seeded", "/books"); err != nil {
+		t.Fatal(err)
+	}
+
+	books, _ := app.Read("/books")
+	authors, _ := app.Read("/authors")
+
+	if len(books.([]any)) != 1 || len(authors.([]any)) != 2 {
+		t.Fatalf("restored books %v and authors %v, want only the books restored", books, authors)
+	}
+
+	if err := app.RestoreSnapshot("seeded", "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := app.Read("/"); !reflect.DeepEqual(got, seeded) {
+		t.Fatalf("restored %v, want %v", got, seeded)
+	}
+
+	if _, ok := app.NamedSnapshots()["seeded"]; !ok {
+		t.Fatal("seeded is not listed")
+	}
+
+	if err := app.DeleteSnapshot("seeded"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.RestoreSnapshot("seeded", "/"); !errors.Is(err, utils.ErrSnapshotNotFound) {
+		t.Fatalf("got %v, want %v", err, utils.ErrSnapshotNotFound)
+	}
+}
+
+func TestReset(t *testing.T) {
+	app := newTestApp(t, "{books: [{id: 1}]}\n")
+	seeded, _ := app.Read("/")
+
+	app.Append("/books", map[string]any{})
+
+	if err := app.Reset("/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := app.Read("/"); !reflect.DeepEqual(got, seeded) {
+		t.Fatalf("reset to %v, want %v", got, seeded)
+	}
+
+	// Resets are changes like any other, so they can be undone
+	if _, err := app.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if books, _ := app.Read("/books"); len(books.([]any)) != 2 {
+		t.Fatalf("undid the reset to %v", books)
+	}
+}
+
+// TestRestoreRemovesAddedPath restores paths that were added after the snapshot, they must be removed
+func TestRestoreRemovesAddedPath(t *testing.T) {
+	app := newTestApp(t, "{books: [{id: 1}]}\n")
+	want := datatree.Clone(app.Snapshot())
+
+	if err := app.SaveSnapshot("seeded"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Write("/tags", []any{"x"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.RestoreSnapshot("seeded", "/tags"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(app.Snapshot(), want) {
+		t.Fatalf("restored %v, want %v", app.Snapshot(), want)
+	}
+
+	// Restoring a path that is missing on both sides changes nothing
+	if err := app.RestoreSnapshot("seeded", "/tags"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resets remove added paths too, and the removal can be undone
+	if err := app.Write("/meta", map[string]any{"v": float64(1)}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Reset("/meta"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.Read("/meta"); !errors.Is(err, datatree.ErrNotFound) {
+		t.Fatalf("/meta is still there after the reset: %v", err)
+	}
+
+	if _, err := app.Undo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.Read("/meta"); err != nil {
+		t.Fatalf("/meta is missing after undoing the reset: %v", err)
+	}
+}
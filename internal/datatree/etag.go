@@ -0,0 +1,43 @@
+package datatree
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// ETag returns a strong entity tag for value, stable across restarts since JSON encoding sorts object keys
+func ETag(value any) string {
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(encoded)
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// MatchETag reports whether an If-Match / If-None-Match header value matches etag.
+// If-Match uses strong comparison, so weak tags (W/"...") only match when weak is true.
+func MatchETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
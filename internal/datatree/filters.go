@@ -0,0 +1,286 @@
+package datatree
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter operator suffixes of query parameters e.g: year_gte=1950, title_like=hobbit
+const (
+	FilterEq     = ""
+	FilterGt     = "_gt"
+	FilterGte    = "_gte"
+	FilterLt     = "_lt"
+	FilterLte    = "_lte"
+	FilterNe     = "_ne"
+	FilterLike   = "_like"
+	FilterIn     = "_in"
+	FilterNin    = "_nin"
+	FilterExists = "_exists"
+)
+
+// filterOperators is ordered so that longer suffixes win over their prefixes (_gte before _gt)
+var filterOperators = []string{FilterGte, FilterGt, FilterLte, FilterLt, FilterNe, FilterLike, FilterNin, FilterIn, FilterExists}
+
+// Filter is a single parsed query condition on a field of the elements of a collection
+type Filter struct {
+	Field string
+	Op    string
+	Value string
+
+	// like is the compiled pattern of a _like filter
+	like *regexp.Regexp
+}
+
+// ParseFilters turns query parameters into filters, splitting off operator suffixes
+func ParseFilters(params map[string]string) []Filter {
+	filters := make([]Filter, 0, len(params))
+
+	for key, value := range params {
+		filter := Filter{Field: key, Op: FilterEq, Value: value}
+
+		for _, op := range filterOperators {
+			if field, ok := strings.CutSuffix(key, op); ok && field != "" {
+				filter.Field, filter.Op = field, op
+				break
+			}
+		}
+
+		// Patterns are case insensitive, invalid ones are matched literally
+		if filter.Op == FilterLike {
+			pattern, err := regexp.Compile("(?i)" + value)
+
+			if err != nil {
+				pattern = regexp.MustCompile("(?i)" + regexp.QuoteMeta(value))
+			}
+
+			filter.like = pattern
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters
+}
+
+// MatchesAll reports whether elem satisfies every filter. Objects are matched on their fields,
+// primitives on the special "value" field.
+func MatchesAll(elem any, filters []Filter) bool {
+	for _, filter := range filters {
+		if !filter.Matches(elem) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Matches reports whether elem satisfies the filter
+func (f Filter) Matches(elem any) bool {
+	val, exists := f.field(elem)
+
+	switch f.Op {
+	case FilterExists:
+		want, err := strconv.ParseBool(f.Value)
+
+		return exists == (err != nil || want)
+
+	case FilterNe:
+		return !exists || !f.any(val, equalsQuery)
+
+	case FilterNin:
+		return !exists || !f.any(val, f.in)
+
+	case FilterEq:
+		return exists && f.any(val, equalsQuery)
+
+	case FilterIn:
+		return exists && f.any(val, f.in)
+
+	case FilterLike:
+		return exists && f.any(val, func(v any, _ string) bool { return f.like.MatchString(fmt.Sprint(v)) })
+
+	default:
+		if !exists {
+			return false
+		}
+
+		order, ok := compareQuery(val, f.Value)
+
+		if !ok {
+			return false
+		}
+
+		switch f.Op {
+		case FilterGt:
+			return order > 0
+		case FilterGte:
+			return order >= 0
+		case FilterLt:
+			return order < 0
+		default:
+			return order <= 0
+		}
+	}
+}
+
+// field returns the value the filter applies to
+func (f Filter) field(elem any) (any, bool) {
+	if _, ok := elem.(map[string]any); ok {
+		return FieldValue(elem, f.Field)
+	}
+
+	// Primitive elements can only be filtered through "value"
+	return elem, f.Field == "value"
+}
+
+// any applies match to val, or to each element of an array field (e.g: tags=fiction)
+func (f Filter) any(val any, match func(v any, want string) bool) bool {
+	if list, ok := val.([]any); ok {
+		for _, item := range list {
+			if match(item, f.Value) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return match(val, f.Value)
+}
+
+// in reports whether v equals one of the comma separated values of the filter
+func (f Filter) in(v any, want string) bool {
+	for _, candidate := range strings.Split(want, ",") {
+		if equalsQuery(v, strings.TrimSpace(candidate)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FieldValue resolves a dotted field path such as "author.name" or "tags.0" inside elem.
+// A key containing dots is matched as a whole first, so {"a.b": 1} stays reachable as "a.b".
+func FieldValue(elem any, fieldPath string) (any, bool) {
+	obj, ok := elem.(map[string]any)
+
+	if !ok {
+		return nil, false
+	}
+
+	if val, exists := obj[fieldPath]; exists {
+		return val, true
+	}
+
+	head, rest, nested := strings.Cut(fieldPath, ".")
+
+	if !nested {
+		return nil, false
+	}
+
+	// Walk into the next object, or into an array element by its index
+	switch child := obj[head].(type) {
+	case map[string]any:
+		return FieldValue(child, rest)
+
+	case []any:
+		indexStr, rest, deeper := strings.Cut(rest, ".")
+		index, err := strconv.Atoi(indexStr)
+
+		if err != nil || index < 0 || index >= len(child) {
+			return nil, false
+		}
+
+		if !deeper {
+			return child[index], true
+		}
+
+		return FieldValue(child[index], rest)
+
+	default:
+		return nil, false
+	}
+}
+
+// equalsQuery compares a data value to a query string value according to the data value's type
+func equalsQuery(val any, want string) bool {
+	switch v := val.(type) {
+	case nil:
+		return want == "null"
+	case float64, bool:
+		order, ok := compareQuery(v, want)
+		return ok && order == 0
+	default:
+		return fmt.Sprint(v) == want
+	}
+}
+
+// compareQuery orders a data value against a query string value: numbers numerically, booleans
+// false < true, ISO dates chronologically and other strings lexically. ok is false when the
+// query value can't be read as the data value's type.
+func compareQuery(val any, want string) (int, bool) {
+	switch v := val.(type) {
+	case float64:
+		w, err := strconv.ParseFloat(want, 64)
+
+		if err != nil {
+			return 0, false
+		}
+
+		return cmp.Compare(v, w), true
+
+	case bool:
+		w, err := strconv.ParseBool(want)
+
+		if err != nil {
+			return 0, false
+		}
+
+		return cmp.Compare(boolRank(v), boolRank(w)), true
+
+	case string:
+		// Dates compare chronologically when both sides parse as ISO 8601
+		if vt, ok := ParseDate(v); ok {
+			if wt, ok := ParseDate(want); ok {
+				return vt.Compare(wt), true
+			}
+		}
+
+		return strings.Compare(v, want), true
+
+	default:
+		return 0, false
+	}
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// dateLayouts are the ISO 8601 forms recognized in data values and query parameters
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseDate reads an ISO 8601 date or timestamp, ok is false for any other string
+func ParseDate(s string) (time.Time, bool) {
+	// Cheap check to skip parsing strings that can't be dates
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return time.Time{}, false
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
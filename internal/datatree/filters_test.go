@@ -0,0 +1,83 @@
+package datatree
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterOperators(t *testing.T) {
+	books := []any{
+		map[string]any{"id": float64(1), "title": "The Hobbit", "year": float64(1937), "published": "1937-09-21", "tags": []any{"fantasy"}},
+		map[string]any{"id": float64(2), "title": "Dune", "year": float64(1965), "published": "1965-08-01", "tags": []any{"sf", "classic"}, "series": "Dune"},
+		map[string]any{"id": float64(10), "title": "Neuromancer", "year": float64(1984), "published": "1984-07-01", "tags": []any{"sf"}},
+	}
+
+	tests := []struct {
+		params map[string]string
+		want   []float64
+	}{
+		{map[string]string{"year_gte": "1965"}, []float64{2, 10}},
+		{map[string]string{"year_gt": "1937", "year_lt": "1984"}, []float64{2}},
+		{map[string]string{"year_lte": "1965"}, []float64{1, 2}},
+		// Numbers compare numerically, not lexically
+		{map[string]string{"id_gt": "9"}, []float64{10}},
+		{map[string]string{"published_gt": "1950-01-01"}, []float64{2, 10}},
+		{map[string]string{"title_ne": "Dune"}, []float64{1, 10}},
+		{map[string]string{"title_like": "^the"}, []float64{1}},
+		{map[string]string{"id_in": "1,10"}, []float64{1, 10}},
+		{map[string]string{"id_nin": "1,10"}, []float64{2}},
+		{map[string]string{"series_exists": "true"}, []float64{2}},
+		{map[string]string{"series_exists": "false"}, []float64{1, 10}},
+		// Array fields match when any element does
+		{map[string]string{"tags": "sf"}, []float64{2, 10}},
+	}
+
+	for _, test := range tests {
+		filters := ParseFilters(test.params)
+		got := []float64{}
+
+		for _, book := range books {
+			if MatchesAll(book, filters) {
+				got = append(got, book.(map[string]any)["id"].(float64))
+			}
+		}
+
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%v: matched %v, want %v", test.params, got, test.want)
+		}
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	book := map[string]any{
+		"author":  map[string]any{"name": "Tolkien"},
+		"tags":    []any{"fantasy", map[string]any{"label": "classic"}},
+		"isbn.13": "978",
+	}
+
+	tests := map[string]any{
+		"author.name":  "Tolkien",
+		"tags.0":       "fantasy",
+		"tags.1.label": "classic",
+		"isbn.13":      "978",
+	}
+
+	for path, want := range tests {
+		if got, ok := FieldValue(book, path); !ok || got != want {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+
+	for _, path := range []string{"author.age", "tags.2", "tags.x", "author.name.first"} {
+		if got, ok := FieldValue(book, path); ok {
+			t.Errorf("%s: got %v, want no value", path, got)
+		}
+	}
+
+	// Nested paths work with every operator
+	filters := ParseFilters(map[string]string{"author.name_like": "^tol"})
+
+	if !MatchesAll(book, filters) {
+		t.Error("author.name_like did not match")
+	}
+}
@@ -2,7 +2,9 @@ package datatree
 
 import (
 	"fmt"
+	"maps"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -18,7 +20,8 @@ func FlattenFilters(vals map[string][]string) map[string]string {
 	return out
 }
 
-func splitPath(urlPath string) []string {
+// SplitPath cleans a URL path and splits it into segments e.g: `/api/items/0` => [api, items, 0]
+func SplitPath(urlPath string) []string {
 	clean := path.Clean("/" + urlPath)
 	trimmed := strings.Trim(clean, "/")
 	if trimmed == "" {
@@ -46,17 +49,17 @@ func traverse(root any, parts []string) (parent any, last string, err error) {
 			nxt, ok := current[segment]
 
 			if !ok {
-				return nil, "", fmt.Errorf("path not found: %q", prefix)
+				return nil, "", fmt.Errorf("%w: path not found: %q", ErrNotFound, prefix)
 			}
 
 			// Move to next element
 			curr = nxt
 
 		case []any:
-			element, _, findErr := findByKey(current, segment)
+			element, _, findErr := findByKey(current, segment, parts[:index])
 
 			if findErr != nil {
-				return nil, "", fmt.Errorf("invalid id/index %q at %q", segment, prefix)
+				return nil, "", fmt.Errorf("%w: invalid id/index %q at %q", ErrNotFound, segment, prefix)
 			}
 
 			// Move to next element
@@ -72,32 +75,52 @@ func traverse(root any, parts []string) (parent any, last string, err error) {
 	return curr, parts[len(parts)-1], nil
 }
 
-func findByKey(slice []any, key string) (elem any, idx int, err error) {
-	key = strings.TrimSpace(key)
+// Positions returns the path to the value at urlPath with every element step replaced by the
+// element's index, e.g: /books/7/title => [books 2 title]. Keys fall back to indexes, so a path
+// only addresses the same element in two trees if its positions are the same in both.
+func Positions(root any, urlPath string) ([]string, error) {
+	parts := SplitPath(urlPath)
+	positions := make([]string, len(parts))
+	curr := root
 
-	// First, try matching an object's "id" field of any type.
-	for i, el := range slice {
-		m, ok := el.(map[string]any)
-		if !ok {
-			continue
-		}
-		raw, has := m["id"]
+	for index, segment := range parts {
+		switch current := curr.(type) {
+		case map[string]any:
+			nxt, ok := current[segment]
 
-		if !has {
-			continue
-		}
+			if !ok {
+				return nil, ErrNotFound
+			}
 
-		// 1) If the raw ID is a string, do a direct comparison.
-		if s, ok := raw.(string); ok && s == key {
-			return m, i, nil
-		}
+			positions[index], curr = segment, nxt
 
-		// 3) If the raw ID is a float64 (the default for JSON numbers):
-		if f, ok := raw.(float64); ok && strconv.Itoa(int(f)) == key {
-			return m, i, nil
+		case []any:
+			element, idx, err := findByKey(current, segment, parts[:index])
+
+			if err != nil {
+				return nil, ErrNotFound
+			}
+
+			positions[index], curr = strconv.Itoa(idx), element
+
+		default:
+			return nil, ErrNotFound
 		}
 	}
 
+	return positions, nil
+}
+
+// findByKey finds an element of the collection at collectionPath by its primary key,
+// falling back to the positional index
+func findByKey(slice []any, key string, collectionPath []string) (elem any, idx int, err error) {
+	key = strings.TrimSpace(key)
+
+	// First, try matching the object's primary key ("id" unless configured otherwise)
+	if elem, idx, err := findByPrimaryKey(slice, key, KeyFields(collectionPath)); err == nil {
+		return elem, idx, nil
+	}
+
 	// Fallback: treat key as a numeric index.
 	if idx, err2 := strconv.Atoi(key); err2 == nil && idx >= 0 && idx < len(slice) {
 		return slice[idx], idx, nil
@@ -106,44 +129,90 @@ func findByKey(slice []any, key string) (elem any, idx int, err error) {
 	return nil, -1, fmt.Errorf("no element with id or index %q", key)
 }
 
-// findElem returns the object (map[string]any) at key by id/index.
-func findElem(slice []any, key string) (map[string]any, int, error) {
-	el, idx, err := findByKey(slice, key)
+// Clone returns a deep copy of a data tree made of maps, slices and primitives.
+func Clone(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, child := range v {
+			out[key] = Clone(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = Clone(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// CopyPath returns a copy of root that only duplicates the containers along urlPath, everything
+// else is shared with root. The copied containers can be changed without touching root, and with
+// deep the value at urlPath is cloned entirely for changes reaching further into it.
+func CopyPath(root map[string]any, urlPath string, deep bool) map[string]any {
+	parts := SplitPath(urlPath)
 
-	if err != nil {
-		return nil, -1, err
+	if deep && len(parts) == 0 {
+		out, _ := Clone(root).(map[string]any)
+		return out
 	}
-	m, ok := el.(map[string]any)
 
-	if !ok {
-		return nil, -1, fmt.Errorf("element at %q is not an object", key)
+	out := maps.Clone(root)
+
+	if out == nil {
+		out = map[string]any{}
 	}
-	return m, idx, nil
-}
 
-// findIndex returns just the index of the element at key by id/index.
-func findIndex(slice []any, key string) (int, error) {
-	_, idx, err := findByKey(slice, key)
-	return idx, err
-}
+	curr := any(out)
+
+	// Swap every container on the way down for a copy, stopping where the path no longer exists
+	for index, segment := range parts {
+		target := deep && index == len(parts)-1
 
-func matchesFilters(elem any, filters map[string]string) bool {
-	for key, want := range filters {
-		switch obj := elem.(type) {
+		switch current := curr.(type) {
 		case map[string]any:
-			val, ok := obj[key]
-			if !ok || fmt.Sprint(val) != want {
-				// this filter didn’t match → don’t drop
-				return false
+			child, ok := current[segment]
+
+			if !ok {
+				return out
 			}
-		default:
-			// primitive slice: only "value" filter makes sense
-			if key == "value" && fmt.Sprint(elem) == want {
-				continue
+
+			curr = copyValue(child, target)
+			current[segment] = curr
+
+		case []any:
+			_, i, err := findByKey(current, segment, parts[:index])
+
+			if err != nil {
+				return out
 			}
-			return false
+
+			curr = copyValue(current[i], target)
+			current[i] = curr
+
+		default:
+			return out
 		}
 	}
-	// every filter matched → drop this element
-	return true
+
+	return out
+}
+
+// copyValue copies a container shallowly, or entirely with deep
+func copyValue(value any, deep bool) any {
+	if deep {
+		return Clone(value)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return maps.Clone(v)
+	case []any:
+		return slices.Clone(v)
+	default:
+		return v
+	}
 }
@@ -0,0 +1,12 @@
+package datatree
+
+// books returns a collection of objects holding only the given ids
+func books(ids ...float64) []any {
+	items := []any{}
+
+	for _, id := range ids {
+		items = append(items, map[string]any{"id": id})
+	}
+
+	return items
+}
@@ -0,0 +1,142 @@
+package datatree
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// IDStrategy decides how ids are generated for objects POSTed to a collection
+	IDStrategy = IDIncrement
+)
+
+const (
+	IDIncrement = "increment"
+	IDUUID      = "uuid"
+	IDULID      = "ulid"
+	IDNanoID    = "nanoid"
+)
+
+func RegisterFlags() {
+	flag.StringVar(&IDStrategy, "id-strategy", IDIncrement, "id generated for objects POSTed to a collection: increment, uuid, ulid or nanoid")
+	flag.StringVar(&IDField, "id-field", "id", "primary key field of collections, used for lookups and id generation")
+	flag.Func("keys", `per-collection primary keys as HJSON or a path to a HJSON file e.g: '{users: "username", orders: ["tenant", "number"]}'`, SetCollectionKeys)
+}
+
+// nextID generates a new value for the key field of an element of slice using the configured strategy
+func nextID(slice []any, field string) (any, error) {
+	switch IDStrategy {
+	case IDIncrement, "":
+		// Numeric max + 1, written as a string if the collection keeps its ids as strings
+		highest, numbers, texts := 0.0, 0, 0
+
+		for _, el := range slice {
+			obj, ok := el.(map[string]any)
+
+			if !ok {
+				continue
+			}
+
+			switch id := obj[field].(type) {
+			case float64:
+				highest = math.Max(highest, id)
+				numbers++
+			case string:
+				n, err := strconv.ParseFloat(id, 64)
+
+				// Ids like "a1" can't be counted up, so a random one is used instead
+				if err != nil {
+					return newUUID()
+				}
+
+				highest = math.Max(highest, n)
+				texts++
+			}
+		}
+
+		id := math.Floor(highest) + 1
+
+		if texts > 0 && numbers == 0 {
+			return strconv.FormatFloat(id, 'f', -1, 64), nil
+		}
+
+		return id, nil
+
+	case IDUUID:
+		return newUUID()
+
+	case IDULID:
+		return newULID()
+
+	case IDNanoID:
+		return newNanoID()
+
+	default:
+		return nil, fmt.Errorf("unknown id strategy %q", IDStrategy)
+	}
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	var b [16]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b[:])
+
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// newULID returns a lexicographically sortable id: 48 bits of milliseconds followed by 80 random bits
+func newULID() (string, error) {
+	const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	var b [16]byte
+
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// Encode the 128 bits as 26 base32 characters, 5 bits at a time from the top
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out), nil
+}
+
+// newNanoID returns a 21 character URL-safe random id
+func newNanoID() (string, error) {
+	const alphabet = "_-0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	b := make([]byte, 21)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// 64 characters, so every random byte maps to one without bias
+	for i := range b {
+		b[i] = alphabet[b[i]&63]
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,104 @@
+package datatree
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestAppendGeneratesIDs(t *testing.T) {
+	root := map[string]any{"books": []any{map[string]any{"id": float64(1)}, map[string]any{"id": "5"}}}
+
+	// Numeric ids continue from the highest one, numeric strings included
+	key, err := Append(root, "/books", map[string]any{"title": "Dune"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []any{map[string]any{"id": float64(1)}, map[string]any{"id": "5"}, map[string]any{"id": float64(6), "title": "Dune"}}
+
+	if key != "6" || !reflect.DeepEqual(root["books"], want) {
+		t.Fatalf("appended %v with key %q, want %v with key 6", root["books"], key, want)
+	}
+
+	// Supplied ids are kept, unless another item already has them
+	if key, err := Append(root, "/books", map[string]any{"id": float64(10)}); err != nil || key != "10" {
+		t.Fatalf("got key %q (err %v), want 10", key, err)
+	}
+
+	if _, err := Append(root, "/books", map[string]any{"id": float64(10)}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, want %v", err, ErrConflict)
+	}
+
+	// Empty collections start at 1 and missing ones are created
+	if key, err := Append(root, "/authors", map[string]any{"name": "Herbert"}); err != nil || key != "1" {
+		t.Fatalf("got key %q (err %v), want 1", key, err)
+	}
+
+	// Collections of primitives are addressed by index
+	root["tags"] = []any{"a"}
+
+	if key, err := Append(root, "/tags", "b"); err != nil || key != "1" {
+		t.Fatalf("got key %q (err %v), want 1", key, err)
+	}
+}
+
+func TestAppendStringIDs(t *testing.T) {
+	tests := []struct {
+		ids    []any
+		format *regexp.Regexp
+	}{
+		// Numeric strings are counted up and stay strings
+		{[]any{"1", "7"}, regexp.MustCompile(`^8$`)},
+		// Other strings can't be counted up, so a UUID is generated
+		{[]any{"a1", float64(2)}, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+	}
+
+	for _, test := range tests {
+		books := []any{}
+
+		for _, id := range test.ids {
+			books = append(books, map[string]any{"id": id})
+		}
+
+		root := map[string]any{"books": books}
+		key, err := Append(root, "/books", map[string]any{})
+
+		if err != nil {
+			t.Fatalf("%v: %v", test.ids, err)
+		}
+
+		added := root["books"].([]any)[len(books)].(map[string]any)
+
+		if id, ok := added["id"].(string); !ok || id != key || !test.format.MatchString(key) {
+			t.Errorf("%v: generated %#v with key %q", test.ids, added["id"], key)
+		}
+	}
+}
+
+func TestIDStrategies(t *testing.T) {
+	defer func(strategy string) { IDStrategy = strategy }(IDStrategy)
+
+	formats := map[string]*regexp.Regexp{
+		IDUUID:   regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		IDULID:   regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`),
+		IDNanoID: regexp.MustCompile(`^[A-Za-z0-9_-]{21}$`),
+	}
+
+	for strategy, format := range formats {
+		IDStrategy = strategy
+		root := map[string]any{"books": []any{}}
+
+		key, err := Append(root, "/books", map[string]any{})
+
+		if err != nil {
+			t.Fatalf("%s: %v", strategy, err)
+		}
+
+		if !format.MatchString(key) {
+			t.Errorf("%s: generated %q", strategy, key)
+		}
+	}
+}
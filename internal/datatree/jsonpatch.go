@@ -0,0 +1,303 @@
+package datatree
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid JSON patch")
+	ErrTestFailed   = errors.New("JSON patch test failed")
+)
+
+// JSONPatch applies an RFC 6902 operation list to the value at urlPath, with JSON pointers relative
+// to that value. Operations are applied in order and in place, so callers needing all-or-nothing
+// semantics (like app.mutate) apply the patch to a copy of the data tree.
+func JSONPatch(root map[string]any, urlPath string, ops []any) error {
+	// Apply the operations to the value at urlPath and write the result back to the same place,
+	// even when the operations change the key it was addressed by
+	return update(root, urlPath, func(target any) (any, error) {
+		for i, raw := range ops {
+			op, ok := raw.(map[string]any)
+
+			if !ok {
+				return nil, fmt.Errorf("%w: operation %d is not an object", ErrInvalidPatch, i)
+			}
+
+			var err error
+
+			if target, err = applyPatchOp(target, op); err != nil {
+				return nil, fmt.Errorf("operation %d (%v %v): %w", i, op["op"], op["path"], err)
+			}
+		}
+
+		return target, nil
+	})
+}
+
+// applyPatchOp performs a single patch operation on doc and returns the resulting document
+func applyPatchOp(doc any, op map[string]any) (any, error) {
+	name, _ := op["op"].(string)
+
+	tokens, err := pointerField(op, "path")
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "add":
+		value, ok := op["value"]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+
+		return addAt(doc, tokens, Clone(value))
+
+	case "remove":
+		return removeAt(doc, tokens)
+
+	case "replace":
+		value, ok := op["value"]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+
+		if len(tokens) == 0 {
+			return Clone(value), nil
+		}
+
+		// Replacing requires the target to exist, unlike add
+		if doc, err = removeAt(doc, tokens); err != nil {
+			return nil, err
+		}
+
+		return addAt(doc, tokens, Clone(value))
+
+	case "move":
+		from, err := pointerField(op, "from")
+
+		if err != nil {
+			return nil, err
+		}
+
+		// A value can't be moved into one of its own children
+		if len(from) < len(tokens) && slices.Equal(from, tokens[:len(from)]) {
+			return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidPatch)
+		}
+
+		value, err := getAt(doc, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if doc, err = removeAt(doc, from); err != nil {
+			return nil, err
+		}
+
+		return addAt(doc, tokens, value)
+
+	case "copy":
+		from, err := pointerField(op, "from")
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := getAt(doc, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return addAt(doc, tokens, Clone(value))
+
+	case "test":
+		value, err := getAt(doc, tokens)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(value, op["value"]) {
+			return nil, ErrTestFailed
+		}
+
+		return doc, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, name)
+	}
+}
+
+// pointerField parses the JSON pointer in op[field] into its unescaped reference tokens
+func pointerField(op map[string]any, field string) ([]string, error) {
+	pointer, ok := op[field].(string)
+
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %q", ErrInvalidPatch, field)
+	}
+
+	// The empty pointer refers to the whole document
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: pointer %q must start with '/'", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// getAt returns the value the tokens point to
+func getAt(doc any, tokens []string) (any, error) {
+	current := doc
+
+	for _, token := range tokens {
+		switch container := current.(type) {
+		case map[string]any:
+			value, ok := container[token]
+
+			if !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, token)
+			}
+
+			current = value
+
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			current = container[index]
+
+		default:
+			return nil, fmt.Errorf("%w: cannot traverse into %T at %q", ErrInvalidPatch, current, token)
+		}
+	}
+
+	return current, nil
+}
+
+// addAt adds value at tokens: object members are set, array elements are inserted ("-" appends)
+func addAt(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return modifyAt(doc, tokens, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+
+		case []any:
+			if token == "-" {
+				return append(c, value), nil
+			}
+
+			index, err := arrayIndex(token, len(c))
+
+			if err != nil {
+				return nil, err
+			}
+
+			return append(c[:index], append([]any{value}, c[index:]...)...), nil
+
+		default:
+			return nil, fmt.Errorf("%w: cannot add to %T", ErrInvalidPatch, container)
+		}
+	})
+}
+
+// removeAt removes the value at tokens, shifting later array elements down
+func removeAt(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	return modifyAt(doc, tokens, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, token)
+			}
+
+			delete(c, token)
+			return c, nil
+
+		case []any:
+			index, err := arrayIndex(token, len(c)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return append(c[:index], c[index+1:]...), nil
+
+		default:
+			return nil, fmt.Errorf("%w: cannot remove from %T", ErrInvalidPatch, container)
+		}
+	})
+}
+
+// modifyAt walks down to the container holding the last token, lets fn change it and writes the
+// (possibly reallocated) containers back up the path
+func modifyAt(node any, tokens []string, fn func(container any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+
+	child, err := getAt(node, tokens[:1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := modifyAt(child, tokens[1:], fn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := node.(type) {
+	case map[string]any:
+		container[tokens[0]] = updated
+	case []any:
+		index, _ := arrayIndex(tokens[0], len(container)-1)
+		container[index] = updated
+	}
+
+	return node, nil
+}
+
+// arrayIndex parses an array index token, which must be a plain non-negative integer up to max
+func arrayIndex(token string, max int) (int, error) {
+	index, err := strconv.Atoi(token)
+
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+
+	if index > max {
+		return 0, fmt.Errorf("%w: array index %d out of bounds", ErrInvalidPatch, index)
+	}
+
+	return index, nil
+}
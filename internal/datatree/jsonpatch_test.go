@@ -0,0 +1,90 @@
+package datatree
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestJSONPatchOperations(t *testing.T) {
+	root := map[string]any{
+		"books": []any{
+			map[string]any{"id": float64(1), "title": "Dune", "tags": []any{"sf"}},
+		},
+	}
+
+	ops := []any{
+		map[string]any{"op": "test", "path": "/title", "value": "Dune"},
+		map[string]any{"op": "replace", "path": "/title", "value": "Dune Messiah"},
+		map[string]any{"op": "add", "path": "/tags/-", "value": "classic"},
+		map[string]any{"op": "add", "path": "/tags/0", "value": "first"},
+		map[string]any{"op": "copy", "from": "/title", "path": "/subtitle"},
+		map[string]any{"op": "move", "from": "/subtitle", "path": "/name"},
+		map[string]any{"op": "remove", "path": "/tags/1"},
+	}
+
+	if err := JSONPatch(root, "/books/1", ops); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"id": float64(1), "title": "Dune Messiah", "name": "Dune Messiah", "tags": []any{"first", "classic"}}
+
+	if got := root["books"].([]any)[0]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("patched %v, want %v", got, want)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := map[string]struct {
+		op   map[string]any
+		want error
+	}{
+		"failed test":       {map[string]any{"op": "test", "path": "/title", "value": "Emma"}, ErrTestFailed},
+		"unknown operation": {map[string]any{"op": "rename", "path": "/title"}, ErrInvalidPatch},
+		"missing value":     {map[string]any{"op": "add", "path": "/year"}, ErrInvalidPatch},
+		"missing target":    {map[string]any{"op": "remove", "path": "/year"}, ErrInvalidPatch},
+		"move into itself":  {map[string]any{"op": "move", "from": "/tags", "path": "/tags/0"}, ErrInvalidPatch},
+	}
+
+	for name, test := range tests {
+		root := map[string]any{"books": []any{map[string]any{"title": "Dune", "tags": []any{}}}}
+
+		if err := JSONPatch(root, "/books/0", []any{test.op}); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", name, err, test.want)
+		}
+	}
+}
+
+// TestJSONPatchChangesKey replaces the id of an item, which must not touch the other items
+func TestJSONPatchChangesKey(t *testing.T) {
+	root := map[string]any{"books": books(1, 2, 3, 4)}
+	ops := []any{map[string]any{"op": "replace", "path": "/id", "value": float64(9)}}
+
+	if err := JSONPatch(root, "/books/1", ops); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := books(9, 2, 3, 4); !reflect.DeepEqual(root["books"], want) {
+		t.Fatalf("patched %v, want %v", root["books"], want)
+	}
+
+	// Writing back by the old id has no positional index to fall back on here
+	root = map[string]any{"books": books(7, 8)}
+
+	if err := JSONPatch(root, "/books/7", ops); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := books(9, 8); !reflect.DeepEqual(root["books"], want) {
+		t.Fatalf("patched %v, want %v", root["books"], want)
+	}
+}
+
+func TestJSONPatchKeyConflict(t *testing.T) {
+	root := map[string]any{"books": books(1, 2)}
+	ops := []any{map[string]any{"op": "replace", "path": "/id", "value": float64(2)}}
+
+	if err := JSONPatch(root, "/books/1", ops); !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, want %v", err, ErrConflict)
+	}
+}
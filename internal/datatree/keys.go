@@ -0,0 +1,156 @@
+package datatree
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hjson/hjson-go"
+)
+
+var (
+	// IDField is the primary key field of collections without a configured key
+	IDField = "id"
+
+	// collectionKeys maps a collection (by name or full path) to its primary key fields
+	collectionKeys = map[string][]string{}
+)
+
+// KeySeparator joins the fields of a composite key in URLs e.g: /orders/acme,42
+const KeySeparator = ","
+
+// SetCollectionKeys parses per-collection primary keys from inline HJSON or a HJSON file, e.g:
+// `{users: "username", orders: ["tenant", "number"]}`
+func SetCollectionKeys(value string) error {
+	raw := []byte(value)
+
+	// The value may also be a path to a file containing the mapping
+	if fileData, err := os.ReadFile(value); err == nil {
+		raw = fileData
+	}
+
+	var parsed map[string]any
+
+	if err := hjson.Unmarshal(raw, &parsed); err != nil {
+		return fmt.Errorf("invalid collection keys %q: %w", value, err)
+	}
+
+	keys := make(map[string][]string, len(parsed))
+
+	for collection, fields := range parsed {
+		switch f := fields.(type) {
+		case string:
+			keys[strings.Trim(collection, "/")] = []string{f}
+		case []any:
+			for _, field := range f {
+				name, ok := field.(string)
+
+				if !ok || name == "" {
+					return fmt.Errorf("key fields of %q must be strings", collection)
+				}
+
+				keys[strings.Trim(collection, "/")] = append(keys[strings.Trim(collection, "/")], name)
+			}
+		default:
+			return fmt.Errorf("key of %q must be a field name or a list of field names", collection)
+		}
+	}
+
+	collectionKeys = keys
+
+	return nil
+}
+
+// KeyFields returns the primary key fields of the collection at collectionPath,
+// matching the configuration by full path first and collection name second
+func KeyFields(collectionPath []string) []string {
+	if fields, ok := collectionKeys[strings.Join(collectionPath, "/")]; ok {
+		return fields
+	}
+
+	if len(collectionPath) > 0 {
+		if fields, ok := collectionKeys[collectionPath[len(collectionPath)-1]]; ok {
+			return fields
+		}
+	}
+
+	return []string{IDField}
+}
+
+// elementKey returns the URL key of an element e.g: "7", or "acme,42" for composite keys
+func elementKey(el any, fields []string) (string, bool) {
+	obj, ok := el.(map[string]any)
+
+	if !ok {
+		return "", false
+	}
+
+	parts := make([]string, len(fields))
+
+	for i, field := range fields {
+		part, ok := keyString(obj[field])
+
+		if !ok {
+			return "", false
+		}
+
+		parts[i] = part
+	}
+
+	return strings.Join(parts, KeySeparator), true
+}
+
+// findByPrimaryKey returns the object whose primary key formats to key
+func findByPrimaryKey(slice []any, key string, fields []string) (map[string]any, int, error) {
+	for i, el := range slice {
+		if got, ok := elementKey(el, fields); ok && got == key {
+			return el.(map[string]any), i, nil
+		}
+	}
+
+	return nil, -1, ErrNotFound
+}
+
+// keyString formats a key field the way it appears in a URL path, only strings and numbers can be keys
+func keyString(id any) (string, bool) {
+	switch v := id.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// usesKeys reports whether objects appended to slice should carry a primary key: the collection
+// is either empty or already holds objects with one
+func usesKeys(slice []any, fields []string) bool {
+	if len(slice) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(slice, func(el any) bool {
+		_, ok := elementKey(el, fields)
+		return ok
+	})
+}
+
+// ElementKey returns the primary key of el as it appears in URLs, for the collection at collectionPath
+func ElementKey(el any, collectionPath []string) (string, bool) {
+	return elementKey(el, KeyFields(collectionPath))
+}
+
+// KeyString formats a foreign key value the way primary keys appear in URLs
+func KeyString(id any) (string, bool) {
+	return keyString(id)
+}
+
+// FindByPrimaryKey returns the element of the collection at collectionPath with the given key,
+// without falling back to positional indexes
+func FindByPrimaryKey(slice []any, key string, collectionPath []string) (map[string]any, bool) {
+	el, _, err := findByPrimaryKey(slice, key, KeyFields(collectionPath))
+	return el, err == nil
+}
@@ -0,0 +1,61 @@
+package datatree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCollectionKeys(t *testing.T) {
+	defer func() { collectionKeys = map[string][]string{} }()
+
+	if err := SetCollectionKeys(`{users: "username", "api/orders": ["tenant", "number"]}`); err != nil {
+		t.Fatal(err)
+	}
+
+	root := map[string]any{
+		"users": []any{map[string]any{"username": "ada"}},
+		"api": map[string]any{
+			"orders": []any{map[string]any{"tenant": "acme", "number": float64(42), "total": float64(9)}},
+		},
+	}
+
+	// Single and composite keys are matched by name and by full path
+	if user, err := Lookup(root, "/users/ada"); err != nil || user.(map[string]any)["username"] != "ada" {
+		t.Fatalf("got %v (err %v), want user ada", user, err)
+	}
+
+	if total, err := Lookup(root, "/api/orders/acme,42/total"); err != nil || total != float64(9) {
+		t.Fatalf("got %v (err %v), want 9", total, err)
+	}
+
+	// The generated key goes in the configured field
+	if key, err := Append(root, "/users", map[string]any{"username": "bob"}); err != nil || key != "bob" {
+		t.Fatalf("got key %q (err %v), want bob", key, err)
+	}
+
+	// Composite keys are never generated
+	if _, err := Append(root, "/api/orders", map[string]any{"tenant": "acme"}); !errors.Is(err, ErrMissingKey) {
+		t.Fatalf("got %v, want %v", err, ErrMissingKey)
+	}
+
+	if err := SetCollectionKeys(`{users: 1}`); err == nil {
+		t.Fatal("accepted a non-string key field")
+	}
+}
+
+func TestIDField(t *testing.T) {
+	defer func(field string) { IDField = field }(IDField)
+
+	IDField = "_id"
+	root := map[string]any{"books": []any{map[string]any{"_id": float64(3)}}}
+
+	key, err := Append(root, "/books", map[string]any{"title": "Dune"})
+
+	if err != nil || key != "4" {
+		t.Fatalf("got key %q (err %v), want 4", key, err)
+	}
+
+	if book, err := Lookup(root, "/books/4/title"); err != nil || book != "Dune" {
+		t.Fatalf("got %v (err %v), want Dune", book, err)
+	}
+}
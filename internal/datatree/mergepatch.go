@@ -0,0 +1,40 @@
+package datatree
+
+// MergePatch applies an RFC 7396 merge patch to the value at urlPath: objects are merged
+// recursively, null members delete the key and any other value replaces the target outright
+func MergePatch(root map[string]any, urlPath string, patch any) error {
+	// Merge into the value at urlPath and write the result back to the same place, even when the
+	// patch changes the key it was addressed by
+	return update(root, urlPath, func(target any) (any, error) {
+		return mergeValue(target, patch), nil
+	})
+}
+
+// mergeValue merges patch into target in place and returns the result
+func mergeValue(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+
+	// Anything but an object replaces the target, arrays included
+	if !ok {
+		return Clone(patch)
+	}
+
+	targetObject, ok := target.(map[string]any)
+
+	// Merging an object into a non-object starts from an empty object
+	if !ok {
+		targetObject = map[string]any{}
+	}
+
+	for key, value := range patchObject {
+		// A null member removes the key
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
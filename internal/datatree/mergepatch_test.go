@@ -0,0 +1,74 @@
+package datatree
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	root := map[string]any{
+		"books": []any{
+			map[string]any{"id": float64(1), "title": "Dune", "meta": map[string]any{"pages": float64(412), "isbn": "x"}, "tags": []any{"sf"}},
+		},
+	}
+
+	// Objects merge recursively, nulls delete and arrays are replaced outright
+	patch := map[string]any{"meta": map[string]any{"isbn": nil, "year": float64(1965)}, "tags": []any{"classic"}, "title": nil}
+
+	if err := MergePatch(root, "/books/1", patch); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"id": float64(1), "meta": map[string]any{"pages": float64(412), "year": float64(1965)}, "tags": []any{"classic"}}
+
+	if got := root["books"].([]any)[0]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("patched %v, want %v", got, want)
+	}
+
+	// A non-object patch replaces the target
+	if err := MergePatch(root, "/books/1/meta", "none"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := root["books"].([]any)[0].(map[string]any)["meta"]; got != "none" {
+		t.Fatalf("got %v, want none", got)
+	}
+}
+
+func TestMergePatchRoot(t *testing.T) {
+	root := map[string]any{"books": []any{}, "meta": map[string]any{"v": float64(1)}}
+
+	if err := MergePatch(root, "/", map[string]any{"meta": nil}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]any{"books": []any{}}; !reflect.DeepEqual(root, want) {
+		t.Fatalf("patched %v, want %v", root, want)
+	}
+
+	if err := MergePatch(root, "/", []any{}); !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidPatch)
+	}
+}
+
+// TestMergePatchChangesKey merges a new id into an item, which must not touch the other items
+func TestMergePatchChangesKey(t *testing.T) {
+	root := map[string]any{"books": books(2, 3, 4)}
+
+	if err := MergePatch(root, "/books/2", map[string]any{"id": float64(10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := books(10, 3, 4); !reflect.DeepEqual(root["books"], want) {
+		t.Fatalf("patched %v, want %v", root["books"], want)
+	}
+}
+
+func TestMergePatchKeyConflict(t *testing.T) {
+	root := map[string]any{"books": books(2, 3, 4)}
+
+	if err := MergePatch(root, "/books/2", map[string]any{"id": float64(4)}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, want %v", err, ErrConflict)
+	}
+}
@@ -0,0 +1,103 @@
+package datatree
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Operation is a single mutation of the data tree, as applied by the app and recorded by storage
+type Operation struct {
+	Verb    string     `json:"verb"`
+	Path    string     `json:"path"`
+	Value   any        `json:"value,omitempty"`
+	Filters url.Values `json:"filters,omitempty"`
+	Key     string     `json:"key,omitempty"`
+	Time    time.Time  `json:"time"`
+
+	// IfMatch is the If-Match header of the request, checked against the current value before applying
+	IfMatch string `json:"-"`
+}
+
+const (
+	OpSet    = "set"
+	OpPatch  = "patch"
+	OpDelete = "delete"
+	OpAppend = "append"
+
+	// OpJSONPatch applies an RFC 6902 operation list (Value) relative to Path
+	OpJSONPatch = "json-patch"
+
+	// OpMergePatch deep merges an RFC 7396 merge patch (Value) into Path
+	OpMergePatch = "merge-patch"
+
+	// OpRemove removes the key or element at Path outright, where OpDelete only empties arrays
+	OpRemove = "remove"
+)
+
+// Writable returns a copy of root the operation can be applied to without changing root. Only the
+// containers along op.Path are copied, plus the whole target for patches reaching into it.
+func (op *Operation) Writable(root map[string]any) map[string]any {
+	return CopyPath(root, op.Path, op.Verb == OpJSONPatch || op.Verb == OpMergePatch)
+}
+
+// Apply performs the operation on the given data tree.
+// Appends record the key of the new element in op.Key, and the generated id in op.Value.
+func (op *Operation) Apply(root map[string]any) error {
+	switch op.Verb {
+	case OpSet:
+		// Set value at the specified path within the data tree
+		return Set(root, op.Path, op.Value)
+
+	case OpPatch:
+		patch, ok := op.Value.(map[string]any)
+
+		if !ok {
+			return fmt.Errorf("patch payload for %q must be an object", op.Path)
+		}
+
+		// Apply the patch to the value at the specified path in the data tree
+		return Patch(root, op.Path, patch)
+
+	case OpJSONPatch:
+		ops, ok := op.Value.([]any)
+
+		if !ok {
+			return fmt.Errorf("%w: payload for %q must be an array of operations", ErrInvalidPatch, op.Path)
+		}
+
+		// Apply every operation in order, the caller discards the tree if any of them fails
+		return JSONPatch(root, op.Path, ops)
+
+	case OpMergePatch:
+		// Recursively merge the patch into the value at the specified path, null deletes keys
+		return MergePatch(root, op.Path, op.Value)
+
+	case OpDelete:
+		// If filters / query params are provided, fire bulk delete
+		if len(op.Filters) > 0 {
+			return BulkDelete(root, op.Path, FlattenFilters(op.Filters))
+		}
+
+		// Single delete on path when no filter is provided
+		return Delete(root, op.Path)
+
+	case OpRemove:
+		// Remove the value at the path, keys holding arrays included
+		return Remove(root, op.Path)
+
+	case OpAppend:
+		// Append the value to the array, assigning an id if the collection uses them
+		key, err := Append(root, op.Path, op.Value)
+
+		if err != nil {
+			return err
+		}
+
+		op.Key = key
+		return nil
+
+	default:
+		return fmt.Errorf("unknown operation %q", op.Verb)
+	}
+}
@@ -0,0 +1,44 @@
+package datatree
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// TestWritableLeavesRootUntouched applies every verb to a writable copy, the original tree must not change
+func TestWritableLeavesRootUntouched(t *testing.T) {
+	ops := []Operation{
+		{Verb: OpSet, Path: "/books/1/title", Value: "B"},
+		{Verb: OpSet, Path: "/", Value: map[string]any{"books": []any{}}},
+		{Verb: OpPatch, Path: "/books/1", Value: map[string]any{"title": "B"}},
+		{Verb: OpPatch, Path: "/meta", Value: map[string]any{"v": float64(2)}},
+		{Verb: OpMergePatch, Path: "/books/1", Value: map[string]any{"tags": map[string]any{"new": true}}},
+		{Verb: OpMergePatch, Path: "/", Value: map[string]any{"meta": nil}},
+		{Verb: OpJSONPatch, Path: "/books/1", Value: []any{map[string]any{"op": "add", "path": "/tags/new", "value": true}}},
+		{Verb: OpJSONPatch, Path: "/", Value: []any{map[string]any{"op": "remove", "path": "/books/0/tags"}}},
+		{Verb: OpDelete, Path: "/books/1"},
+		{Verb: OpDelete, Path: "/books", Filters: url.Values{"title": {"A"}}},
+		{Verb: OpDelete, Path: "/meta"},
+		{Verb: OpRemove, Path: "/books"},
+		{Verb: OpRemove, Path: "/books/1"},
+		{Verb: OpAppend, Path: "/books", Value: map[string]any{"title": "C"}},
+		{Verb: OpAppend, Path: "/authors", Value: map[string]any{"name": "D"}},
+	}
+
+	for _, op := range ops {
+		root := map[string]any{
+			"books": []any{map[string]any{"id": float64(1), "title": "A", "tags": map[string]any{"old": true}}},
+			"meta":  map[string]any{"v": float64(1)},
+		}
+		want := Clone(root)
+
+		if err := op.Apply(op.Writable(root)); err != nil {
+			t.Fatalf("%s %s: %v", op.Verb, op.Path, err)
+		}
+
+		if !reflect.DeepEqual(root, want) {
+			t.Errorf("%s %s changed the original tree: %v", op.Verb, op.Path, root)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package datatree
+
+import (
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SearchHit is an element matching a full-text search, along with where it lives
+type SearchHit struct {
+	Path       string `json:"path"`
+	Collection string `json:"collection"`
+	Item       any    `json:"item"`
+}
+
+// SearchTokens splits a search query into lower-cased terms e.g: "Lord  Rings" => [lord, rings]
+func SearchTokens(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// MatchesText reports whether every token is a case-insensitive substring of some string
+// value inside value, searching nested objects and arrays recursively
+func MatchesText(value any, tokens []string) bool {
+	for _, token := range tokens {
+		if !containsText(value, token) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsText(value any, token string) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(strings.ToLower(v), token)
+	case map[string]any:
+		for _, child := range v {
+			if containsText(child, token) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if containsText(child, token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Search returns the elements of every collection (array) in the data tree matching query,
+// in a stable order. Matching elements are not searched for nested collections.
+func Search(root any, query string) []SearchHit {
+	hits := []SearchHit{}
+	tokens := SearchTokens(query)
+
+	if len(tokens) == 0 {
+		return hits
+	}
+
+	var walk func(value any, parts []string)
+
+	walk = func(value any, parts []string) {
+		switch v := value.(type) {
+		case map[string]any:
+			// Visit object keys in sorted order so results don't shuffle between requests
+			keys := make([]string, 0, len(v))
+
+			for key := range v {
+				keys = append(keys, key)
+			}
+
+			slices.Sort(keys)
+
+			for _, key := range keys {
+				walk(v[key], append(slices.Clone(parts), key))
+			}
+
+		case []any:
+			fields := KeyFields(parts)
+
+			for i, elem := range v {
+				// Address elements by their primary key when they have one, otherwise by index
+				key, ok := elementKey(elem, fields)
+
+				if !ok {
+					key = strconv.Itoa(i)
+				}
+
+				if MatchesText(elem, tokens) {
+					hits = append(hits, SearchHit{
+						Path:       "/" + path.Join(append(slices.Clone(parts), key)...),
+						Collection: "/" + strings.Join(parts, "/"),
+						Item:       elem,
+					})
+
+					continue
+				}
+
+				walk(elem, append(slices.Clone(parts), key))
+			}
+		}
+	}
+
+	walk(root, nil)
+
+	return hits
+}
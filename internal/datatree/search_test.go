@@ -0,0 +1,40 @@
+package datatree
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	root := map[string]any{
+		"books": []any{
+			map[string]any{"id": float64(1), "title": "The Lord of the Rings", "author": map[string]any{"name": "Tolkien"}},
+			map[string]any{"id": float64(2), "title": "Dune"},
+		},
+		"api": map[string]any{
+			"tags": []any{"rings", "sand"},
+		},
+	}
+
+	// Every term must match somewhere in the item, nested fields included
+	if !MatchesText(root["books"].([]any)[0], SearchTokens("lord TOLKIEN")) {
+		t.Error("terms spread over nested fields did not match")
+	}
+
+	if MatchesText(root["books"].([]any)[0], SearchTokens("lord dune")) {
+		t.Error("matched although dune is missing")
+	}
+
+	want := []SearchHit{
+		{Path: "/api/tags/0", Collection: "/api/tags", Item: "rings"},
+		{Path: "/books/1", Collection: "/books", Item: root["books"].([]any)[0]},
+	}
+
+	if got := Search(root, "Rings"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if got := Search(root, "  "); len(got) != 0 {
+		t.Fatalf("got %v for a blank query", got)
+	}
+}
@@ -4,14 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"maps"
+	"strconv"
 	"strings"
 )
 
-var ErrNotFound = errors.New("value not found in datatree")
+var (
+	ErrNotFound   = errors.New("value not found in datatree")
+	ErrNotArray   = errors.New("value is not an array")
+	ErrConflict   = errors.New("an element with this key already exists")
+	ErrMissingKey = errors.New("missing primary key fields")
+)
 
 func Lookup(appData any, urlPath string) (any, error) {
 	// Split URL into separate segments | e.g: `/api/items/0` => [api, items, 0]
-	urlParts := splitPath(urlPath)
+	urlParts := SplitPath(urlPath)
 
 	// Return full app data if URL path is root (`/`)
 	if len(urlParts) == 0 {
@@ -39,7 +45,7 @@ func Lookup(appData any, urlPath string) (any, error) {
 
 	case []any:
 		// Find target element in array by either ID prop or fallback to positional index
-		result, _, err := findByKey(parent, lastSegment)
+		result, _, err := findByKey(parent, lastSegment, urlParts[:len(urlParts)-1])
 
 		if err != nil {
 			return nil, ErrNotFound
@@ -56,7 +62,12 @@ func Lookup(appData any, urlPath string) (any, error) {
 
 func Set(root any, urlPath string, newVal any) error {
 	// Split the URL path into segments e.g: `/api/books/1` => [api,books,1]
-	urlParts := splitPath(urlPath)
+	urlParts := SplitPath(urlPath)
+
+	// Setting the root replaces the whole document, which has to stay an object
+	if len(urlParts) == 0 {
+		return replaceRoot(root, newVal)
+	}
 
 	// Traverse the app.Data to get the parent container & last segment for given URL path
 	parentContainer, lastSegment, err := traverse(root, urlParts)
@@ -74,26 +85,121 @@ func Set(root any, urlPath string, newVal any) error {
 		return nil
 
 	case []any:
-		// Find target index in array by either ID prop or fallback to positional index
-		index, err := findIndex(parent, lastSegment)
+		// Replace the element at its index, found by either ID prop or positional index, refusing
+		// a new primary key that another element already has
+		return update(root, urlPath, func(any) (any, error) {
+			return newVal, nil
+		})
+
+	default:
+		// We only support maps/objects & arrays/slices for a parent container
+		return fmt.Errorf("cannot set on non-collection at %q", urlPath)
+	}
+}
+
+// replaceRoot swaps the contents of the root object for those of newVal
+func replaceRoot(root any, newVal any) error {
+	rootObject, ok := root.(map[string]any)
+	replacement, isObject := newVal.(map[string]any)
+
+	if !ok || !isObject {
+		return fmt.Errorf("the root can only be replaced by an object, got %T", newVal)
+	}
+
+	// Copy before clearing, newVal may share its maps with the root
+	replacement = maps.Clone(replacement)
+
+	clear(rootObject)
+	maps.Copy(rootObject, replacement)
+
+	return nil
+}
+
+// update replaces the value at urlPath with the result of fn. Array elements are found before fn
+// runs and written back to the same index, so fn may change an element's primary key as long as
+// no other element of the collection already has the new one.
+func update(root any, urlPath string, fn func(value any) (any, error)) error {
+	// Split the URL path into segments e.g: /api/books/1 => [api,books,1]
+	parts := SplitPath(urlPath)
+
+	// The root can't be swapped out, so an updated root has its contents replaced instead
+	if len(parts) == 0 {
+		value, err := fn(root)
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := value.(map[string]any); !ok {
+			return fmt.Errorf("%w: the root must remain an object", ErrInvalidPatch)
+		}
+
+		return replaceRoot(root, value)
+	}
+
+	// Get the parent container (map or array) and the final path segment
+	parent, lastSegment, err := traverse(root, parts)
+
+	if err != nil {
+		return err
+	}
+
+	switch parentContainer := parent.(type) {
+	case map[string]any:
+		current, exists := parentContainer[lastSegment]
+
+		if !exists {
+			return ErrNotFound
+		}
+
+		value, err := fn(current)
+
+		if err != nil {
+			return err
+		}
+
+		parentContainer[lastSegment] = value
+
+		return nil
+
+	case []any:
+		// Resolve the element before fn can change the key it was addressed by
+		collectionPath := parts[:len(parts)-1]
+		_, index, err := findByKey(parentContainer, lastSegment, collectionPath)
+
+		if err != nil {
+			return ErrNotFound
+		}
+
+		value, err := fn(parentContainer[index])
 
 		if err != nil {
 			return err
 		}
 
-		// Assign the new value to correct location using index
-		parent[index] = newVal
+		// A changed primary key must stay unique within the collection
+		fields := KeyFields(collectionPath)
+
+		if key, ok := elementKey(value, fields); ok {
+			for i, elem := range parentContainer {
+				if other, ok := elementKey(elem, fields); ok && other == key && i != index {
+					return fmt.Errorf("%w: %v", ErrConflict, key)
+				}
+			}
+		}
+
+		parentContainer[index] = value
+
 		return nil
 
 	default:
-		// We only support maps/objects & arrays/slices for a parent container
-		return fmt.Errorf("cannot set on non-collection at %q", urlPath)
+		return fmt.Errorf("cannot update non-collection at %q", urlPath)
 	}
 }
 
 func Delete(root any, urlPath string) error {
 	// Split URL into separate segments | e.g: `/api/items/0` => [api, items, 0]
-	urlParts := splitPath(urlPath)
+	urlParts := SplitPath(urlPath)
 
 	// Dont allow client to delete whole hson document by making DELETE request to root
 	if len(urlParts) == 0 {
@@ -125,7 +231,7 @@ func Delete(root any, urlPath string) error {
 
 	case []any:
 		// find the index for element we want to delete
-		_, index, err := findByKey(parentContainer, lastSegment)
+		_, index, err := findByKey(parentContainer, lastSegment, urlParts[:len(urlParts)-1])
 
 		if err != nil {
 			return err
@@ -143,6 +249,38 @@ func Delete(root any, urlPath string) error {
 	}
 }
 
+// Remove deletes the value at urlPath outright. Unlike Delete, a key holding an array is removed
+// rather than emptied.
+func Remove(root any, urlPath string) error {
+	urlParts := SplitPath(urlPath)
+
+	// The whole document can't be removed
+	if len(urlParts) == 0 {
+		return ErrNotFound
+	}
+
+	parent, lastSegment, err := traverse(root, urlParts)
+
+	if err != nil {
+		return err
+	}
+
+	parentContainer, ok := parent.(map[string]any)
+
+	// Array elements are removed the same way Delete removes them
+	if !ok {
+		return Delete(root, urlPath)
+	}
+
+	if _, exists := parentContainer[lastSegment]; !exists {
+		return ErrNotFound
+	}
+
+	delete(parentContainer, lastSegment)
+
+	return nil
+}
+
 func BulkDelete(root any, urlPath string, filters map[string]string) error {
 	// If no filters, perform a single delete (by ID or index).
 	if len(filters) == 0 {
@@ -162,13 +300,16 @@ func BulkDelete(root any, urlPath string, filters map[string]string) error {
 		return fmt.Errorf("value at %q is not a slice", urlPath)
 	}
 
+	// Parse operator suffixes e.g: year_lt=1950 once for all elements
+	parsed := ParseFilters(filters)
+
 	// Init a new arr to write back to app store
 	kept := make([]any, 0, len(slice))
 
 	// Loop through elements and only keep elements that don't match the filters
 	// If they match the filters, we skip them and they inevitably get deleted
 	for _, elem := range slice {
-		if matchesFilters(elem, filters) {
+		if MatchesAll(elem, parsed) {
 			continue
 		}
 
@@ -179,53 +320,71 @@ func BulkDelete(root any, urlPath string, filters map[string]string) error {
 	return Set(root, urlPath, kept)
 }
 
-func Patch(root any, urlPath string, patch map[string]any) error {
-	// Split the URL path into segments e.g: /api/books/1 => [api,books,1]
-	parts := splitPath(urlPath)
+// Append adds item to the array at urlPath (creating the array if it is missing) and returns the
+// key of the new element: its id when the collection is keyed by id, otherwise its index
+func Append(root any, urlPath string, item any) (string, error) {
+	// Lookup the existing value at urlPath, a missing value starts a new array
+	existing, err := Lookup(root, urlPath)
 
-	// Get the parent container (map or array) and the final path segment  e.g: /api/book/1 => parent: /api/book & last: "1"
-	parent, lastSegment, err := traverse(root, parts)
+	if err != nil && err != ErrNotFound {
+		return "", err
+	}
 
-	if err != nil {
-		return err
+	slice, ok := existing.([]any)
+
+	if existing != nil && !ok {
+		return "", ErrNotArray
 	}
 
-	// Type check parent container to ensure it is a map type
-	// Patch only valid for modifying objects / maps
-	switch parentContainer := parent.(type) {
-	case map[string]any:
-		// Get the target value at the final segment
-		data, exists := parentContainer[lastSegment]
+	fields := KeyFields(SplitPath(urlPath))
 
-		if !exists {
-			return ErrNotFound
-		}
+	// Objects posted to a keyed collection get the next id, or have their key checked for duplicates
+	if obj, ok := item.(map[string]any); ok && usesKeys(slice, fields) {
+		key, hasKey := elementKey(obj, fields)
 
-		// Make sure target value is an object to allow valid patch
-		targetObject, ok := data.(map[string]any)
+		if !hasKey {
+			// Composite keys can't be generated, the client has to supply them
+			if len(fields) > 1 {
+				return "", fmt.Errorf("%w: %s", ErrMissingKey, strings.Join(fields, ", "))
+			}
 
-		if !ok {
-			return fmt.Errorf("cannot patch non-object at %q", urlPath)
+			id, err := nextID(slice, fields[0])
+
+			if err != nil {
+				return "", err
+			}
+
+			obj[fields[0]] = id
+			key, _ = elementKey(obj, fields)
+		} else if _, _, err := findByPrimaryKey(slice, key, fields); err == nil {
+			return "", fmt.Errorf("%w: %v", ErrConflict, key)
 		}
 
-		// Copy patch / shallow merge into target object
-		maps.Copy(targetObject, patch)
+		return key, Set(root, urlPath, append(slice, obj))
+	}
 
-		return nil
+	// Without ids the new element is addressed by its positional index
+	return strconv.Itoa(len(slice)), Set(root, urlPath, append(slice, item))
+}
 
-	case []any:
-		// Find target element in arr, ensuring it is an obj
-		obj, _, err := findElem(parentContainer, lastSegment)
+func Patch(root any, urlPath string, patch map[string]any) error {
+	// The root can't be patched, only replaced
+	if len(SplitPath(urlPath)) == 0 {
+		return ErrNotFound
+	}
 
-		if err != nil {
-			return err
+	// Shallow merge the patch into the target object and write it back to the same place, even
+	// when the patch changes the key it was addressed by
+	return update(root, urlPath, func(target any) (any, error) {
+		// Patch only valid for modifying objects / maps
+		targetObject, ok := target.(map[string]any)
+
+		if !ok {
+			return nil, fmt.Errorf("cannot patch non-object at %q", urlPath)
 		}
 
-		// Copy patch / shallow merge into target object
-		maps.Copy(obj, patch)
-		return nil
+		maps.Copy(targetObject, patch)
 
-	default:
-		return fmt.Errorf("cannot patch non-collection at %q", urlPath)
-	}
+		return targetObject, nil
+	})
 }
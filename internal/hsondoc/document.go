@@ -0,0 +1,352 @@
+package hsondoc
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Scalar Kind = iota
+	Object
+	Array
+)
+
+// Node is a parsed HJSON value along with the byte span it occupies in the source
+type Node struct {
+	Kind    Kind
+	Value   any
+	Start   int
+	End     int
+	Members []*Member
+	Elems   []*Node
+
+	// braces is false only for a root object written without braces
+	braces bool
+}
+
+// spans returns the [start, end) byte range of every child, keys included for object members
+func (node *Node) spans() [][2]int {
+	spans := make([][2]int, 0, len(node.Members)+len(node.Elems))
+
+	for _, member := range node.Members {
+		spans = append(spans, [2]int{member.Start, member.Value.End})
+	}
+
+	for _, elem := range node.Elems {
+		spans = append(spans, [2]int{elem.Start, elem.End})
+	}
+
+	return spans
+}
+
+// Member is a single key / value pair of an object node
+type Member struct {
+	Key   string
+	Start int
+	Value *Node
+}
+
+// Document is a parsed HJSON file that remembers its comments, whitespace and key order
+type Document struct {
+	src  []byte
+	root *Node
+
+	// Formatting conventions detected from the source, used when rendering new values
+	eol       string
+	unit      string
+	jsonStyle bool
+}
+
+// Parse reads HJSON (or plain JSON) source into a Document
+func Parse(src []byte) (*Document, error) {
+	p := &parser{src: src}
+
+	root, err := p.rootValue()
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{src: src, root: root, eol: "\n", unit: detectIndentUnit(src)}
+
+	if bytes.Contains(src, []byte("\r\n")) {
+		doc.eol = "\r\n"
+	}
+
+	// Files that quote their first key are treated as JSON and get JSON formatted additions
+	if root.Kind == Object && root.braces && len(root.Members) > 0 {
+		doc.jsonStyle = src[root.Members[0].Start] == '"'
+	}
+
+	return doc, nil
+}
+
+// Value returns the decoded data of the document
+func (doc *Document) Value() any {
+	return doc.root.Value
+}
+
+// Bytes returns the source the document was parsed from
+func (doc *Document) Bytes() []byte {
+	return doc.src
+}
+
+// Update renders value as HJSON, reusing the original bytes (comments, key order, formatting)
+// for every part of the document whose value did not change
+func (doc *Document) Update(value any) ([]byte, error) {
+	out := new(bytes.Buffer)
+
+	// Keep anything before and after the root value, e.g. leading comments
+	out.Write(doc.src[:doc.root.Start])
+
+	if err := doc.render(out, doc.root, value, lineIndent(doc.src, doc.root.Start), false); err != nil {
+		return nil, err
+	}
+
+	out.Write(doc.src[doc.root.End:])
+
+	return out.Bytes(), nil
+}
+
+// render writes value to out, copying source bytes for the parts of node that are unchanged
+func (doc *Document) render(out *bytes.Buffer, node *Node, value any, indent string, inline bool) error {
+	// Unchanged values keep their exact original bytes, except for a value missing at the end of
+	// the input: left empty, whatever gets written after it would be read as its value
+	if reflect.DeepEqual(node.Value, value) && (node.Kind != Scalar || node.End > node.Start) {
+		out.Write(doc.src[node.Start:node.End])
+		return nil
+	}
+
+	if node.Kind == Scalar && node.End == node.Start {
+		out.WriteString(" ")
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if node.Kind == Object && len(node.Members) > 0 {
+			return doc.renderObject(out, node, v)
+		}
+	case []any:
+		if node.Kind == Array && len(node.Elems) > 0 {
+			return doc.renderArray(out, node, v)
+		}
+	}
+
+	// Types differ or the container was empty, so render the value from scratch
+	encoded, err := doc.encode(value, indent, inline || hasTrailingText(doc.src, node.End))
+
+	if err != nil {
+		return err
+	}
+
+	out.WriteString(encoded)
+
+	return nil
+}
+
+func (doc *Document) renderObject(out *bytes.Buffer, node *Node, value map[string]any) error {
+	members := node.Members
+	first, last := members[0], members[len(members)-1]
+
+	childIndent := lineIndent(doc.src, first.Start)
+	sep := doc.separator(node, node.spans())
+	inline := sep == ", "
+
+	// Opening brace and whatever trivia comes before the first member
+	out.Write(doc.src[node.Start:first.Start])
+
+	// The comma or comment on the last member's line stays with that member, in front of any new
+	// key, and is dropped along with it
+	sameLine, rest := splitTrailing(doc.src[last.Value.End:node.End], node.braces)
+
+	written, prev := 0, -1
+	seen := make(map[string]bool, len(members))
+
+	// Same-line text of the previous member that its original gap to the next one doesn't carry
+	var pending []byte
+
+	for i, member := range members {
+		newVal, kept := value[member.Key]
+
+		// Members missing from the new value are dropped along with their leading comments
+		if !kept {
+			continue
+		}
+
+		seen[member.Key] = true
+
+		// Reuse the original gap (comma, comments, newline) in front of this member
+		if written > 0 {
+			if prev == i-1 {
+				out.WriteString(doc.gap(members[i-1].Value.End, member.Start, true, sep))
+			} else {
+				lead, gapSep := trailingSep(pending, sep)
+				out.WriteString(lead + doc.gap(members[i-1].Value.End, member.Start, false, gapSep))
+			}
+		}
+
+		// Keep the key exactly as written, only the value is re-rendered if it changed
+		out.Write(doc.src[member.Start:member.Value.Start])
+
+		if err := doc.render(out, member.Value, newVal, childIndent, inline); err != nil {
+			return err
+		}
+
+		written, prev = written+1, i
+		pending = sameLine
+
+		if i < len(members)-1 {
+			pending = lineEnd(doc.src[member.Value.End:members[i+1].Start])
+		}
+	}
+
+	// Append new keys after the existing ones, sorted for stable output
+	for _, key := range sortedKeys(value) {
+		if seen[key] {
+			continue
+		}
+
+		encoded, err := doc.encode(value[key], childIndent, inline)
+
+		if err != nil {
+			return fmt.Errorf("cannot encode %q: %w", key, err)
+		}
+
+		if written > 0 {
+			lead, keySep := trailingSep(pending, sep)
+			out.WriteString(lead + keySep)
+		}
+
+		out.WriteString(doc.quoteKey(key) + ": " + encoded)
+
+		written, pending = written+1, nil
+	}
+
+	// Trailing trivia and the closing brace
+	out.Write(pending)
+	out.Write(rest)
+
+	return nil
+}
+
+func (doc *Document) renderArray(out *bytes.Buffer, node *Node, value []any) error {
+	elems := node.Elems
+	first, last := elems[0], elems[len(elems)-1]
+
+	childIndent := lineIndent(doc.src, first.Start)
+	sep := doc.separator(node, node.spans())
+	inline := sep == ", "
+
+	// Pair every new element with the original element it came from, if any
+	matches := matchElements(elems, value)
+
+	// Opening bracket and whatever trivia comes before the first element
+	out.Write(doc.src[node.Start:first.Start])
+
+	// The comma or comment on an element's line stays with that element wherever it goes
+	sameLine, rest := splitTrailing(doc.src[last.End:node.End], true)
+
+	var pending []byte
+
+	for i, newVal := range value {
+		k := matches[i]
+
+		if i > 0 {
+			lead, elemSep := trailingSep(pending, sep)
+			adjacent := k > 0 && matches[i-1] == k-1
+
+			// Reuse the original gap in front of a matched element, otherwise use the detected separator
+			if adjacent {
+				out.WriteString(doc.gap(elems[k-1].End, elems[k].Start, true, sep))
+			} else if k > 0 {
+				out.WriteString(lead + doc.gap(elems[k-1].End, elems[k].Start, false, elemSep))
+			} else {
+				out.WriteString(lead + elemSep)
+			}
+		}
+
+		if k < 0 {
+			encoded, err := doc.encode(newVal, childIndent, inline)
+
+			if err != nil {
+				return err
+			}
+
+			out.WriteString(encoded)
+			pending = nil
+			continue
+		}
+
+		if err := doc.render(out, elems[k], newVal, childIndent, inline); err != nil {
+			return err
+		}
+
+		pending = sameLine
+
+		if k < len(elems)-1 {
+			pending = lineEnd(doc.src[elems[k].End:elems[k+1].Start])
+		}
+	}
+
+	// Trailing trivia and the closing bracket
+	out.Write(pending)
+	out.Write(rest)
+
+	return nil
+}
+
+// gap returns the text to write in front of the child starting at start, given the original gap
+// that preceded it. If the previous original child was dropped or moved, its trailing same-line
+// text (comma, comment) is cut off so it doesn't end up attached to a different child.
+func (doc *Document) gap(prevEnd, start int, adjacent bool, sep string) string {
+	text := string(doc.src[prevEnd:start])
+
+	if adjacent {
+		return text
+	}
+
+	idx := strings.IndexByte(text, '\n')
+
+	if idx < 0 {
+		return text
+	}
+
+	// Drop a trailing '\r' of a CRLF line ending along with the trailing text
+	if idx > 0 && text[idx-1] == '\r' {
+		idx--
+	}
+
+	if strings.HasPrefix(sep, ",") {
+		return "," + text[idx:]
+	}
+
+	return text[idx:]
+}
+
+// separator works out what to write between two children that have no original gap,
+// following the container's style (one child per line or inline, with or without commas)
+func (doc *Document) separator(node *Node, spans [][2]int) string {
+	// Commas are used if any existing gap between children contains one
+	comma := ""
+
+	for i := 1; i < len(spans); i++ {
+		if strings.Contains(stripComments(doc.src[spans[i-1][1]:spans[i][0]]), ",") {
+			comma = ","
+			break
+		}
+	}
+
+	// Inline containers keep new children on the same line
+	firstStart := spans[0][0]
+	bracketed := node.Kind == Array || node.braces
+
+	if bracketed && !bytes.Contains(doc.src[node.Start:firstStart], []byte("\n")) {
+		return ", "
+	}
+
+	return comma + doc.eol + lineIndent(doc.src, firstStart)
+}
@@ -0,0 +1,152 @@
+package hsondoc
+
+import (
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// update applies change to a copy of the document's root object and parses the result back
+func update(t *testing.T, src string, change func(value map[string]any)) (string, any) {
+	t.Helper()
+
+	doc, err := Parse([]byte(src))
+
+	if err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+
+	value := maps.Clone(doc.Value().(map[string]any))
+	change(value)
+
+	out, err := doc.Update(value)
+
+	if err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+
+	next, err := Parse(out)
+
+	if err != nil {
+		t.Fatalf("%q: rendered invalid HJSON %q: %v", src, out, err)
+	}
+
+	if !reflect.DeepEqual(next.Value(), value) {
+		t.Fatalf("%q: rendered %q, reading back %v, want %v", src, out, next.Value(), value)
+	}
+
+	return string(out), value
+}
+
+func TestUpdateUnchanged(t *testing.T) {
+	for _, src := range parityCorpus {
+		doc, err := Parse([]byte(src))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if out, err := doc.Update(doc.Value()); err != nil || string(out) != src {
+			t.Errorf("%q: rendered %q (err %v)", src, out, err)
+		}
+	}
+}
+
+func TestUpdateEmptyValueAtEOF(t *testing.T) {
+	for _, src := range []string{"a: 1\nb:", "books: []\nnote:\n", "a: 1\nb: # comment\n"} {
+		out, _ := update(t, src, func(value map[string]any) { value["b"], value["note"] = "x", "y" })
+
+		if !strings.HasPrefix(out, src[:strings.IndexByte(src, ':')]) {
+			t.Errorf("%q: rendered %q", src, out)
+		}
+
+		// Other keys can be written while the empty value stays
+		update(t, src, func(value map[string]any) { value["c"] = []any{float64(1)} })
+	}
+}
+
+func TestUpdateKeepsComments(t *testing.T) {
+	src := "# books\n{\n  // the list\n  books: [\n    1 # first\n    2\n  ]\n  text:\n    '''\n    multi\n    line\n    '''\n}\n"
+
+	// Unchanged multiline strings keep their exact bytes
+	out, _ := update(t, src, func(value map[string]any) { value["books"] = []any{float64(1), float64(2), float64(3)} })
+
+	for _, kept := range []string{"# books\n", "// the list", "1 # first", "    '''\n    multi\n    line\n    '''"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("rendered %q without %q", out, kept)
+		}
+	}
+
+	update(t, src, func(value map[string]any) { value["text"] = "one\ntwo" })
+	update(t, src, func(value map[string]any) { delete(value, "text") })
+}
+
+func TestUpdateCommentOnlyFile(t *testing.T) {
+	for _, src := range []string{"# only a comment\n", "", "// notes\n\n"} {
+		out, _ := update(t, src, func(value map[string]any) { value["books"] = []any{map[string]any{"id": float64(1)}} })
+
+		if !strings.HasPrefix(out, src) {
+			t.Errorf("%q: rendered %q without the comment", src, out)
+		}
+	}
+}
+
+// TestUpdateTrailingComments checks that the comment on a child's line stays with that child,
+// behind the comma, when its neighbours are added, removed or moved
+func TestUpdateTrailingComments(t *testing.T) {
+	one, two := map[string]any{"id": float64(1)}, map[string]any{"id": float64(2)}
+
+	tests := []struct {
+		src    string
+		change func(value map[string]any)
+		want   string
+	}{
+		{
+			"l: [\n  1 # first\n  2 # last\n]\n",
+			func(value map[string]any) { value["l"] = []any{float64(1), float64(2), float64(3)} },
+			"l: [\n  1 # first\n  2 # last\n  3\n]\n",
+		},
+		{
+			"l: [\n  {id: 1} # first\n  {id: 2} # last\n]\n",
+			func(value map[string]any) { value["l"] = []any{two, one} },
+			"l: [\n  {id: 2} # last\n  {id: 1} # first\n]\n",
+		},
+		{
+			"l: [\n  1, # first\n  2, # second\n  3\n]\n",
+			func(value map[string]any) { value["l"] = []any{float64(1), float64(3)} },
+			"l: [\n  1, # first\n  3\n]\n",
+		},
+		{
+			"{\"l\": [\n  1,\n  2 // last\n]}\n",
+			func(value map[string]any) { value["l"] = []any{float64(1), float64(2), float64(3)} },
+			"{\"l\": [\n  1,\n  2, // last\n  3\n]}\n",
+		},
+		{
+			"l: [1, 2 /* last */]\n",
+			func(value map[string]any) { value["l"] = []any{float64(1), float64(2), float64(3)} },
+			"l: [1, 2, /* last */ 3]\n",
+		},
+		{
+			"{\n  \"a\": 1,\n  \"c\": 1 // last\n}\n",
+			func(value map[string]any) { value["b"] = "y" },
+			"{\n  \"a\": 1,\n  \"c\": 1, // last\n  \"b\": \"y\"\n}\n",
+		},
+		{
+			"a: 1 # one\nc: 2 # two\n",
+			func(value map[string]any) { delete(value, "c"); value["b"] = float64(2) },
+			"a: 1 # one\nb: 2\n",
+		},
+		{
+			"a: 1 # one\nc: 2 # two\n",
+			func(value map[string]any) { delete(value, "a") },
+			"c: 2 # two\n",
+		},
+	}
+
+	for _, test := range tests {
+		if out, _ := update(t, test.src, test.change); out != test.want {
+			t.Errorf("%q: rendered %q, want %q", test.src, out, test.want)
+		}
+	}
+}
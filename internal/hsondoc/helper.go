@@ -0,0 +1,274 @@
+package hsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hjson/hjson-go"
+)
+
+// Same rule the hjson encoder uses to decide whether a key needs quotes
+var needsQuotedName = regexp.MustCompile(`[,\{\[\}\]\s:#"']|//|/\*`)
+
+// encode renders a value that has no original bytes to reuse, indented to fit at indent
+func (doc *Document) encode(value any, indent string, inline bool) (string, error) {
+	if doc.jsonStyle {
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent(indent, doc.unit)
+
+		if err := enc.Encode(value); err != nil {
+			return "", err
+		}
+
+		return strings.ReplaceAll(strings.TrimRight(buf.String(), "\n"), "\n", doc.eol), nil
+	}
+
+	opts := hjson.DefaultOptions()
+	opts.Eol = doc.eol
+	opts.BracesSameLine = true
+	opts.IndentBy = doc.unit
+	opts.BaseIndentation = indent
+
+	// Quoteless strings run to the end of the line, so quote them when anything else follows
+	opts.QuoteAlways = inline
+
+	encoded, err := hjson.MarshalWithOptions(value, opts)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(string(encoded), indent), nil
+}
+
+func (doc *Document) quoteKey(key string) string {
+	if doc.jsonStyle || key == "" || needsQuotedName.MatchString(key) {
+		quoted, _ := json.Marshal(key)
+		return string(quoted)
+	}
+
+	return key
+}
+
+// matchElements pairs every new array element with the index of the original element it
+// most likely came from (-1 for new elements), so edits keep the comments around records
+func matchElements(elems []*Node, value []any) []int {
+	matches := make([]int, len(value))
+	used := make([]bool, len(elems))
+
+	// Index original object elements by id so edited and reordered records still pair up
+	byID := map[string]int{}
+
+	for k, elem := range elems {
+		if id, ok := elementID(elem.Value); ok {
+			if _, dup := byID[id]; !dup {
+				byID[id] = k
+			}
+		}
+	}
+
+	free := func(k int) bool { return k >= 0 && k < len(elems) && !used[k] }
+
+	cursor := 0
+
+	for i, newVal := range value {
+		k := -1
+		newID, hasID := elementID(newVal)
+
+		if free(cursor) && reflect.DeepEqual(elems[cursor].Value, newVal) {
+			// Unchanged element in its original place
+			k = cursor
+		} else if j, ok := byID[newID]; hasID && ok && free(j) {
+			// Same record, possibly edited or moved
+			k = j
+		} else if free(cursor+1) && reflect.DeepEqual(elems[cursor+1].Value, newVal) {
+			// The original element in front of it was removed
+			k = cursor + 1
+		} else if free(cursor) && sameContainer(elems[cursor].Value, newVal) {
+			// Edited in place, as long as both don't carry different ids
+			if _, oldHasID := elementID(elems[cursor].Value); !(oldHasID && hasID) {
+				k = cursor
+			}
+		}
+
+		matches[i] = k
+
+		if k >= 0 {
+			used[k] = true
+			cursor = k + 1
+		}
+	}
+
+	return matches
+}
+
+func elementID(value any) (string, bool) {
+	obj, ok := value.(map[string]any)
+
+	if !ok {
+		return "", false
+	}
+
+	id, ok := obj["id"]
+
+	if !ok {
+		return "", false
+	}
+
+	encoded, err := json.Marshal(id)
+
+	return string(encoded), err == nil
+}
+
+func sameContainer(a, b any) bool {
+	switch a.(type) {
+	case map[string]any:
+		_, ok := b.(map[string]any)
+		return ok
+	case []any:
+		_, ok := b.([]any)
+		return ok
+	default:
+		return false
+	}
+}
+
+// lineIndent returns the whitespace in front of pos if pos is the first thing on its line
+func lineIndent(src []byte, pos int) string {
+	lineStart := bytes.LastIndexByte(src[:pos], '\n') + 1
+	prefix := src[lineStart:pos]
+
+	if len(bytes.TrimLeft(prefix, " \t")) != 0 {
+		// Something else precedes pos on this line, fall back to that line's indentation
+		return string(prefix[:len(prefix)-len(bytes.TrimLeft(prefix, " \t"))])
+	}
+
+	return string(prefix)
+}
+
+// hasTrailingText reports whether anything other than whitespace follows pos on its line
+func hasTrailingText(src []byte, pos int) bool {
+	for _, c := range src[pos:] {
+		switch c {
+		case '\n', '\r':
+			return false
+		case ' ', '\t':
+			continue
+		default:
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitTrailing splits the text after the last child of a container into the part on the child's
+// own line (a comma or comment) and the rest, e.g: " # last\n}" => " # last", "\n}"
+func splitTrailing(text []byte, closing bool) (sameLine, rest []byte) {
+	idx := bytes.IndexByte(text, '\n')
+
+	if idx < 0 {
+		idx = len(text)
+
+		// Without a line break the closing brace or bracket is part of the rest
+		if closing && idx > 0 {
+			idx--
+		}
+	}
+
+	if idx > 0 && text[idx-1] == '\r' {
+		idx--
+	}
+
+	return text[:idx], text[idx:]
+}
+
+// lineEnd returns the text in front of the first line break, e.g: ", # one\n  # two\n" => ", # one",
+// or nil if there is no line break
+func lineEnd(text []byte) []byte {
+	sameLine, rest := splitTrailing(text, false)
+
+	if len(rest) == 0 {
+		return nil
+	}
+
+	return sameLine
+}
+
+// trailingSep returns the same-line text of a child to write in front of the next child and the
+// separator left to write after it. The comma goes before a comment, where it isn't commented out.
+func trailingSep(sameLine []byte, sep string) (string, string) {
+	text := bytes.TrimLeft(sameLine, " \t")
+
+	if len(text) == 0 || !strings.HasPrefix(sep, ",") {
+		return string(sameLine), sep
+	}
+
+	if text[0] == ',' {
+		return string(sameLine), sep[1:]
+	}
+
+	return "," + string(sameLine), sep[1:]
+}
+
+// detectIndentUnit returns the indentation of the first indented line, defaulting to two spaces
+func detectIndentUnit(src []byte) string {
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		trimmed := bytes.TrimLeft(line, " \t")
+
+		if len(trimmed) > 0 && len(trimmed) < len(line) && trimmed[0] != '\r' {
+			return string(line[:len(line)-len(trimmed)])
+		}
+	}
+
+	return "  "
+}
+
+// stripComments removes comments from the whitespace between two values
+func stripComments(gap []byte) string {
+	var out strings.Builder
+
+	for i := 0; i < len(gap); i++ {
+		switch {
+		case gap[i] == '#' || gap[i] == '/' && i+1 < len(gap) && gap[i+1] == '/':
+			for i < len(gap) && gap[i] != '\n' {
+				i++
+			}
+		case gap[i] == '/' && i+1 < len(gap) && gap[i+1] == '*':
+			end := bytes.Index(gap[i+2:], []byte("*/"))
+
+			if end < 0 {
+				return out.String()
+			}
+
+			i += end + 3
+		default:
+			out.WriteByte(gap[i])
+		}
+	}
+
+	return out.String()
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// removeMember drops the member with the given key, used when a later duplicate key shadows it
+func removeMember(members []*Member, key string) []*Member {
+	return slices.DeleteFunc(members, func(m *Member) bool { return m.Key == key })
+}
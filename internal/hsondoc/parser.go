@@ -0,0 +1,561 @@
+package hsondoc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parser mirrors the hjson-go decoder but records the byte span of every value it reads
+type parser struct {
+	src []byte
+	pos int
+}
+
+var escapee = map[byte]byte{
+	'"':  '"',
+	'\'': '\'',
+	'\\': '\\',
+	'/':  '/',
+	'b':  '\b',
+	'f':  '\f',
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+}
+
+func isPunctuatorChar(c byte) bool {
+	return c == '{' || c == '}' || c == '[' || c == ']' || c == ',' || c == ':'
+}
+
+// ch returns the current character, or 0 at the end of input
+func (p *parser) ch() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) peek(offset int) byte {
+	if i := p.pos + offset; i >= 0 && i < len(p.src) {
+		return p.src[i]
+	}
+	return 0
+}
+
+func (p *parser) errAt(message string) error {
+	line, col := 1, 0
+
+	for i := 0; i < p.pos && i < len(p.src); i++ {
+		if p.src[i] == '\n' {
+			line++
+			col = 0
+		} else {
+			col++
+		}
+	}
+
+	return fmt.Errorf("%s at line %d,%d", message, line, col)
+}
+
+// white skips whitespace and comments
+func (p *parser) white() {
+	for p.ch() > 0 {
+		for p.ch() > 0 && p.ch() <= ' ' {
+			p.pos++
+		}
+
+		if p.ch() == '#' || p.ch() == '/' && p.peek(1) == '/' {
+			for p.ch() > 0 && p.ch() != '\n' {
+				p.pos++
+			}
+		} else if p.ch() == '/' && p.peek(1) == '*' {
+			p.pos += 2
+			for p.ch() > 0 && !(p.ch() == '*' && p.peek(1) == '/') {
+				p.pos++
+			}
+			if p.ch() > 0 {
+				p.pos += 2
+			}
+		} else {
+			break
+		}
+	}
+}
+
+func (p *parser) rootValue() (*Node, error) {
+	// Braces for the root object are optional
+	p.white()
+
+	switch p.ch() {
+	case '{':
+		return p.checkTrailing(p.readObject(false))
+	case '[':
+		return p.checkTrailing(p.readArray())
+	}
+
+	// Assume we have a root object without braces
+	res, err := p.checkTrailing(p.readObject(true))
+
+	if err == nil {
+		return res, nil
+	}
+
+	// Test if we are dealing with a single JSON value instead (true/false/null/num/"")
+	p.pos = 0
+
+	if res2, err2 := p.checkTrailing(p.readValue()); err2 == nil {
+		return res2, nil
+	}
+
+	return nil, err
+}
+
+func (p *parser) checkTrailing(node *Node, err error) (*Node, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	p.white()
+
+	if p.ch() > 0 {
+		return nil, p.errAt("Syntax error, found trailing characters")
+	}
+
+	return node, nil
+}
+
+func (p *parser) readValue() (*Node, error) {
+	valueStart := p.pos
+
+	p.white()
+
+	switch p.ch() {
+	case 0:
+		// The input ended before the value, e.g: `note:` on the last line. It reads as an empty
+		// string placed right after the ':', so rewriting it doesn't land inside a trailing comment.
+		return &Node{Kind: Scalar, Value: "", Start: valueStart, End: valueStart}, nil
+	case '{':
+		return p.readObject(false)
+	case '[':
+		return p.readArray()
+	case '"', '\'':
+		start := p.pos
+		str, err := p.readString(true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Node{Kind: Scalar, Value: str, Start: start, End: p.pos}, nil
+	default:
+		return p.readTfnns()
+	}
+}
+
+func (p *parser) readObject(withoutBraces bool) (*Node, error) {
+	node := &Node{Kind: Object, Start: p.pos, braces: !withoutBraces}
+	object := map[string]any{}
+
+	if !withoutBraces {
+		// Skip the opening '{'
+		p.pos++
+	}
+
+	p.white()
+
+	if p.ch() == '}' && !withoutBraces {
+		p.pos++
+		node.End = p.pos
+		node.Value = object
+		return node, nil
+	}
+
+	for p.ch() > 0 {
+		keyStart := p.pos
+		key, err := p.readKeyname()
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.white()
+
+		if p.ch() != ':' {
+			return nil, p.errAt("Expected ':' instead of '" + string(p.ch()) + "'")
+		}
+
+		p.pos++
+
+		val, err := p.readValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Duplicate keys overwrite the previous value, so drop the shadowed member
+		if _, dup := object[key]; dup {
+			node.Members = removeMember(node.Members, key)
+		}
+
+		object[key] = val.Value
+		node.Members = append(node.Members, &Member{Key: key, Start: keyStart, Value: val})
+
+		p.white()
+
+		// In Hjson the comma is optional and trailing commas are allowed
+		if p.ch() == ',' {
+			p.pos++
+			p.white()
+		}
+
+		if p.ch() == '}' && !withoutBraces {
+			p.pos++
+			node.End = p.pos
+			node.Value = object
+			return node, nil
+		}
+
+		p.white()
+	}
+
+	if withoutBraces {
+		node.End = len(p.src)
+		node.Value = object
+		return node, nil
+	}
+
+	return nil, p.errAt("End of input while parsing an object (did you forget a closing '}'?)")
+}
+
+func (p *parser) readArray() (*Node, error) {
+	node := &Node{Kind: Array, Start: p.pos}
+	array := make([]any, 0, 1)
+
+	// Skip the opening '['
+	p.pos++
+	p.white()
+
+	if p.ch() == ']' {
+		p.pos++
+		node.End = p.pos
+		node.Value = array
+		return node, nil
+	}
+
+	for p.ch() > 0 {
+		val, err := p.readValue()
+
+		if err != nil {
+			return nil, err
+		}
+
+		array = append(array, val.Value)
+		node.Elems = append(node.Elems, val)
+
+		p.white()
+
+		// In Hjson the comma is optional and trailing commas are allowed
+		if p.ch() == ',' {
+			p.pos++
+			p.white()
+		}
+
+		if p.ch() == ']' {
+			p.pos++
+			node.End = p.pos
+			node.Value = array
+			return node, nil
+		}
+
+		p.white()
+	}
+
+	return nil, p.errAt("End of input while parsing an array (did you forget a closing ']'?)")
+}
+
+func (p *parser) readKeyname() (string, error) {
+	// Quotes for keys are optional in Hjson unless they include {}[],: or whitespace
+	if p.ch() == '"' || p.ch() == '\'' {
+		return p.readString(false)
+	}
+
+	name := new(bytes.Buffer)
+	start := p.pos
+	space := -1
+
+	for {
+		switch c := p.ch(); {
+		case c == ':':
+			if name.Len() == 0 {
+				return "", p.errAt("Found ':' but no key name (for an empty key name use quotes)")
+			} else if space >= 0 && space != name.Len() {
+				p.pos = start + space
+				return "", p.errAt("Found whitespace in your key name (use quotes to include)")
+			}
+			return name.String(), nil
+		case c <= ' ':
+			if c == 0 {
+				return "", p.errAt("Found EOF while looking for a key name (check your syntax)")
+			}
+			if space < 0 {
+				space = name.Len()
+			}
+		default:
+			if isPunctuatorChar(c) {
+				return "", p.errAt("Found '" + string(c) + "' where a key name was expected (check your syntax or use quotes if the key name includes {}[],: or whitespace)")
+			}
+			name.WriteByte(c)
+		}
+
+		p.pos++
+	}
+}
+
+// readString parses a quoted string, the current character must be the opening quote
+func (p *parser) readString(allowML bool) (string, error) {
+	res := new(bytes.Buffer)
+	quoteStart := p.pos
+	exitCh := p.ch()
+
+	for p.pos++; p.ch() > 0; p.pos++ {
+		c := p.ch()
+
+		if c == exitCh {
+			p.pos++
+
+			// ''' indicates a multiline string
+			if allowML && exitCh == '\'' && p.ch() == '\'' && res.Len() == 0 {
+				p.pos++
+				return p.readMLString(quoteStart)
+			}
+
+			return res.String(), nil
+		}
+
+		if c == '\\' {
+			p.pos++
+
+			if p.ch() == 'u' {
+				uffff := 0
+
+				for i := 0; i < 4; i++ {
+					p.pos++
+
+					hex, err := strconv.ParseUint(string(p.ch()), 16, 8)
+
+					if err != nil {
+						return "", p.errAt("Bad \\u char " + string(p.ch()))
+					}
+
+					uffff = uffff*16 + int(hex)
+				}
+
+				res.WriteRune(rune(uffff))
+			} else if ech, ok := escapee[p.ch()]; ok {
+				res.WriteByte(ech)
+			} else {
+				return "", p.errAt("Bad escape \\" + string(p.ch()))
+			}
+		} else if c == '\n' || c == '\r' {
+			return "", p.errAt("Bad string containing newline")
+		} else {
+			res.WriteByte(c)
+		}
+	}
+
+	return "", p.errAt("Bad string")
+}
+
+// readMLString parses a triple quoted multiline string, the position must be right after the opening quotes
+func (p *parser) readMLString(quoteStart int) (string, error) {
+	res := new(bytes.Buffer)
+	triple := 0
+
+	// Lines are de-indented by the column of the opening '''
+	indent := quoteStart - (bytes.LastIndexByte(p.src[:quoteStart], '\n') + 1)
+
+	skipIndent := func() {
+		for skip := indent; p.ch() > 0 && p.ch() <= ' ' && p.ch() != '\n' && skip > 0; skip-- {
+			p.pos++
+		}
+	}
+
+	// Skip white up to the first newline
+	for p.ch() > 0 && p.ch() <= ' ' && p.ch() != '\n' {
+		p.pos++
+	}
+
+	if p.ch() == '\n' {
+		p.pos++
+		skipIndent()
+	}
+
+	lastLf := false
+
+	for {
+		c := p.ch()
+
+		if c == 0 {
+			return "", p.errAt("Bad multiline string")
+		} else if c == '\'' {
+			triple++
+			p.pos++
+
+			if triple == 3 {
+				out := res.Bytes()
+
+				// Remove the last EOL
+				if lastLf {
+					return string(out[:len(out)-1]), nil
+				}
+
+				return string(out), nil
+			}
+
+			continue
+		}
+
+		for ; triple > 0; triple-- {
+			res.WriteByte('\'')
+			lastLf = false
+		}
+
+		if c == '\n' {
+			res.WriteByte('\n')
+			lastLf = true
+			p.pos++
+			skipIndent()
+		} else {
+			if c != '\r' {
+				res.WriteByte(c)
+				lastLf = false
+			}
+			p.pos++
+		}
+	}
+}
+
+// readTfnns parses a quoteless value: true, false, null, a number or a quoteless string
+func (p *parser) readTfnns() (*Node, error) {
+	if isPunctuatorChar(p.ch()) {
+		return nil, p.errAt("Found a punctuator character '" + string(p.ch()) + "' when expecting a quoteless string (check your syntax)")
+	}
+
+	start := p.pos
+	chf := p.ch()
+
+	for {
+		p.pos++
+
+		c := p.ch()
+		isEol := c == '\r' || c == '\n' || c == 0
+
+		if isEol || c == ',' || c == '}' || c == ']' || c == '#' || c == '/' && (p.peek(1) == '/' || p.peek(1) == '*') {
+			raw := string(p.src[start:p.pos])
+			trimmed := strings.TrimSpace(raw)
+			end := start + len(strings.TrimRight(raw, " \t\r\n\f\v"))
+
+			switch chf {
+			case 'f':
+				if trimmed == "false" {
+					return &Node{Kind: Scalar, Value: false, Start: start, End: end}, nil
+				}
+			case 'n':
+				if trimmed == "null" {
+					return &Node{Kind: Scalar, Value: nil, Start: start, End: end}, nil
+				}
+			case 't':
+				if trimmed == "true" {
+					return &Node{Kind: Scalar, Value: true, Start: start, End: end}, nil
+				}
+			default:
+				if chf == '-' || chf >= '0' && chf <= '9' {
+					if n, err := parseNumber(raw); err == nil {
+						return &Node{Kind: Scalar, Value: n, Start: start, End: end}, nil
+					}
+				}
+			}
+
+			if isEol {
+				// Any whitespace at the end is ignored in quoteless strings
+				return &Node{Kind: Scalar, Value: trimmed, Start: start, End: end}, nil
+			}
+		}
+	}
+}
+
+// parseNumber accepts the same number syntax as the hjson decoder
+func parseNumber(text string) (float64, error) {
+	i := 0
+	leadingZeros := 0
+	testLeading := true
+
+	at := func() byte {
+		if i < len(text) {
+			return text[i]
+		}
+		return 0
+	}
+
+	if at() == '-' {
+		i++
+	}
+
+	for at() >= '0' && at() <= '9' {
+		if testLeading {
+			if at() == '0' {
+				leadingZeros++
+			} else {
+				testLeading = false
+			}
+		}
+		i++
+	}
+
+	// A single 0 is allowed
+	if testLeading {
+		leadingZeros--
+	}
+
+	if at() == '.' {
+		for i++; at() >= '0' && at() <= '9'; i++ {
+		}
+	}
+
+	if at() == 'e' || at() == 'E' {
+		i++
+		if at() == '-' || at() == '+' {
+			i++
+		}
+		for at() >= '0' && at() <= '9' {
+			i++
+		}
+	}
+
+	end := i
+
+	// Only whitespace may follow the number
+	for at() > 0 && at() <= ' ' {
+		i++
+	}
+
+	if at() > 0 || leadingZeros != 0 {
+		return 0, errors.New("invalid number")
+	}
+
+	number, err := strconv.ParseFloat(text[:end], 64)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, errors.New("invalid number")
+	}
+
+	return number, nil
+}
@@ -0,0 +1,88 @@
+package hsondoc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hjson/hjson-go"
+)
+
+// parityCorpus is read the same by Parse and hjson.Unmarshal
+var parityCorpus = []string{
+	"{}",
+	"",
+	"# only a comment\n",
+	"// only a comment",
+	"/* only a comment */",
+	"a: 1\nb: true\nc: null\nd: -1.5e3\n",
+	"{\"a\": [1, 2, {\"b\": \"c\"}], \"d\": {}}",
+	"a: quoteless string with spaces   \nb: 'single' # trailing comment\n",
+	"a: 01\nb: 1x\nc: trueish\n",
+	"text:\n  '''\n  first\n    indented\n  last\n  '''\n",
+	"a: '''inline'''\n",
+	"a: [\n  1\n  2,\n]\n",
+	"{a: \"\\u00e9\\n\\t\"}",
+	"a: {b: {c: [[], {}]}}\n",
+	"[1, \"two\", {three: 3}]",
+	"\"just a string\"",
+	"42",
+	"a: 1\r\nb: x\r\n",
+	// Input that isn't a valid object is read as a single quoteless string
+	"a 1",
+	"a: '''open",
+}
+
+func TestParseParity(t *testing.T) {
+	for _, src := range parityCorpus {
+		var want any
+
+		if err := hjson.Unmarshal([]byte(src), &want); err != nil {
+			t.Fatalf("%q: hjson: %v", src, err)
+		}
+
+		doc, err := Parse([]byte(src))
+
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+
+		if got := doc.Value(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %#v, want %#v", src, got, want)
+		}
+	}
+}
+
+// TestParseEmptyValueAtEOF reads a value missing at the very end of the input as an empty string,
+// where hjson.Unmarshal reads a NUL character past the end
+func TestParseEmptyValueAtEOF(t *testing.T) {
+	tests := map[string]map[string]any{
+		"a: 1\nb:":           {"a": float64(1), "b": ""},
+		"books: []\nnote:\n": {"books": []any{}, "note": ""},
+		"a:   \n\n":          {"a": ""},
+		"a: # comment":       {"a": ""},
+	}
+
+	for src, want := range tests {
+		doc, err := Parse([]byte(src))
+
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+			continue
+		}
+
+		node := doc.root.Members[len(doc.root.Members)-1].Value
+
+		if !reflect.DeepEqual(doc.Value(), want) || node.End > len(src) {
+			t.Errorf("%q: got %#v spanning [%d, %d), want %#v", src, doc.Value(), node.Start, node.End, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{"{a:}", "{a: 1", "[1, 2", "{a: '''open}", "{a 1}"} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("%q: parsed without an error", src)
+		}
+	}
+}
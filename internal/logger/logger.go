@@ -45,6 +45,11 @@ func Fatal(msg string, keyvals ...any) {
 }
 
 func logMessage(level log.Level, msg string, keyvals ...any) {
+	// Nothing is logged until Setup has run, e.g. in tests
+	if logger == nil {
+		return
+	}
+
 	fields := append([]any(nil), keyvals...)
 
 	if Verbose {
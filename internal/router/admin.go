@@ -0,0 +1,177 @@
+package router
+
+import (
+	"encoding/json"
+	"hson-server/internal/datatree"
+	"hson-server/internal/logger"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+func handleHistoryRequest(store HSONStore) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		// The history is read only, changes are reverted through undo / redo
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", "GET")
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		undo, redo := store.History()
+
+		writeAdminResponse(writer, request, map[string]any{"undo": undo, "redo": redo})
+	}
+}
+
+func handleUndoRequest(store HSONStore) http.HandlerFunc {
+	return handleRevertRequest("Undo", store.Undo)
+}
+
+func handleRedoRequest(store HSONStore) http.HandlerFunc {
+	return handleRevertRequest("Redo", store.Redo)
+}
+
+// handleRevertRequest serves undo and redo, responding with the operation that was reverted or reapplied
+func handleRevertRequest(action string, revert func() (datatree.Operation, error)) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		if request.Method != http.MethodPost {
+			writer.Header().Set("Allow", "POST")
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		op, err := revert()
+
+		if err != nil {
+			handleStoreError(writer, request, err, action+" operation failed")
+			return
+		}
+
+		writeAdminResponse(writer, request, op)
+
+		logger.Info(action+" request completed ✅",
+			"verb", op.Verb,
+			"path", op.Path,
+			"request_duration", time.Since(start),
+		)
+	}
+}
+
+func writeAdminResponse(writer http.ResponseWriter, request *http.Request, body any) {
+	// Set Content type header to indiciate JSON response
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		logger.Error("Failed to encode JSON response", "path", request.URL.Path, "error", err)
+	}
+}
+
+func handleSnapshotListRequest(store HSONStore) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", "GET")
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// List the snapshots by name so the response is stable
+		saved := store.NamedSnapshots()
+		snapshots := make([]map[string]any, 0, len(saved))
+
+		for _, name := range slices.Sorted(maps.Keys(saved)) {
+			snapshots = append(snapshots, map[string]any{"name": name, "saved": saved[name]})
+		}
+
+		writeAdminResponse(writer, request, snapshots)
+	}
+}
+
+// handleSnapshotRequest serves /__admin/snapshots/{name} (POST saves, DELETE forgets) and
+// /__admin/snapshots/{name}/restore (POST restores, scoped by ?path=)
+func handleSnapshotRequest(store HSONStore) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		// Get the snapshot name and action e.g: /__admin/snapshots/seeded/restore => seeded, restore
+		name, action, _ := strings.Cut(strings.TrimPrefix(request.URL.Path, "/__admin/snapshots/"), "/")
+
+		if name == "" || (action != "" && action != "restore") {
+			http.NotFound(writer, request)
+			return
+		}
+
+		var err error
+		status := http.StatusNoContent
+
+		switch {
+		case action == "restore" && request.Method == http.MethodPost:
+			err = store.RestoreSnapshot(name, scopePath(request))
+
+		case action == "" && request.Method == http.MethodPost:
+			err, status = store.SaveSnapshot(name), http.StatusCreated
+
+		case action == "" && request.Method == http.MethodDelete:
+			err = store.DeleteSnapshot(name)
+
+		default:
+			if action == "" {
+				writer.Header().Set("Allow", "POST,DELETE")
+			} else {
+				writer.Header().Set("Allow", "POST")
+			}
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			handleStoreError(writer, request, err, "Snapshot operation failed")
+			return
+		}
+
+		writer.WriteHeader(status)
+
+		logger.Info("Snapshot request completed ✅",
+			"method", request.Method,
+			"snapshot", name,
+			"action", action,
+			"path", scopePath(request),
+			"status", status,
+			"request_duration", time.Since(start),
+		)
+	}
+}
+
+func handleResetRequest(store HSONStore) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		if request.Method != http.MethodPost {
+			writer.Header().Set("Allow", "POST")
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := store.Reset(scopePath(request)); err != nil {
+			handleStoreError(writer, request, err, "Reset operation failed")
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+
+		logger.Info("Reset request completed ✅",
+			"path", scopePath(request),
+			"request_duration", time.Since(start),
+		)
+	}
+}
+
+// scopePath is the subtree a restore or reset is limited to e.g: ?path=/books, the whole tree by default
+func scopePath(request *http.Request) string {
+	return path.Clean("/" + request.URL.Query().Get("path"))
+}
@@ -0,0 +1,158 @@
+package router
+
+import (
+	"hson-server/internal/datatree"
+	"slices"
+	"strings"
+)
+
+// Aggregation lists the summaries requested with ?_count, ?_sum=, ?_avg=, ?_min=, ?_max= and ?_groupBy=
+type Aggregation struct {
+	Count   bool
+	Sum     []string
+	Avg     []string
+	Min     []string
+	Max     []string
+	GroupBy string
+}
+
+func (agg Aggregation) active() bool {
+	return agg.Count || len(agg.Sum) > 0 || len(agg.Avg) > 0 || len(agg.Min) > 0 || len(agg.Max) > 0 || agg.GroupBy != ""
+}
+
+// splitFields reads a comma separated list of field paths e.g: price,stats.rating
+func splitFields(list string) []string {
+	var fields []string
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// aggregate summarizes items as {count, sum: {field: n}, avg: {...}, min: {...}, max: {...}},
+// or as one such object per distinct value of the group-by field, ordered by that value
+func aggregate(items []any, agg Aggregation, numeric bool) any {
+	if agg.GroupBy == "" {
+		return summarize(items, agg, numeric)
+	}
+
+	// Collect the items of every group, remembering the order groups were first seen in
+	var keys []any
+	groups := map[string][]any{}
+
+	for _, item := range items {
+		value, ok := datatree.FieldValue(item, agg.GroupBy)
+		if !ok {
+			value = nil
+		}
+
+		id := groupID(value)
+		if _, seen := groups[id]; !seen {
+			keys = append(keys, value)
+		}
+		groups[id] = append(groups[id], item)
+	}
+
+	// Order groups by their value, with the missing/null group last
+	slices.SortStableFunc(keys, func(a, b any) int {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		case b == nil:
+			return -1
+		}
+		return compareValues(a, b, numeric)
+	})
+
+	out := make([]any, 0, len(keys))
+	for _, key := range keys {
+		summary := summarize(groups[groupID(key)], agg, numeric)
+		summary[agg.GroupBy] = key
+		out = append(out, summary)
+	}
+	return out
+}
+
+// groupID distinguishes group values of different types, e.g: 1 and "1"
+func groupID(value any) string {
+	return datatree.ETag(value)
+}
+
+func summarize(items []any, agg Aggregation, numeric bool) map[string]any {
+	// The count is always included, it is what every other summary is relative to
+	out := map[string]any{"count": len(items)}
+
+	if len(agg.Sum) > 0 {
+		sums := map[string]any{}
+		for _, field := range agg.Sum {
+			sum, _ := sumField(items, field)
+			sums[field] = sum
+		}
+		out["sum"] = sums
+	}
+
+	if len(agg.Avg) > 0 {
+		avgs := map[string]any{}
+		for _, field := range agg.Avg {
+			// Averages only cover items where the field is a number, null if there are none
+			sum, n := sumField(items, field)
+			avgs[field] = nil
+			if n > 0 {
+				avgs[field] = sum / float64(n)
+			}
+		}
+		out["avg"] = avgs
+	}
+
+	if len(agg.Min) > 0 {
+		mins := map[string]any{}
+		for _, field := range agg.Min {
+			mins[field] = extreme(items, field, numeric, -1)
+		}
+		out["min"] = mins
+	}
+
+	if len(agg.Max) > 0 {
+		maxes := map[string]any{}
+		for _, field := range agg.Max {
+			maxes[field] = extreme(items, field, numeric, 1)
+		}
+		out["max"] = maxes
+	}
+
+	return out
+}
+
+// sumField adds up the numeric values of field, returning how many items had one
+func sumField(items []any, field string) (float64, int) {
+	sum, n := 0.0, 0
+	for _, item := range items {
+		if value, ok := datatree.FieldValue(item, field); ok {
+			if number, ok := value.(float64); ok {
+				sum += number
+				n++
+			}
+		}
+	}
+	return sum, n
+}
+
+// extreme returns the smallest (sign -1) or largest (sign 1) non-null value of field, using the
+// same type-aware ordering as sort, so dates and strings work too. Null if no item has the field.
+func extreme(items []any, field string, numeric bool, sign int) any {
+	var best any
+	for _, item := range items {
+		value, ok := datatree.FieldValue(item, field)
+		if !ok || value == nil {
+			continue
+		}
+		if best == nil || compareValues(value, best, numeric)*sign > 0 {
+			best = value
+		}
+	}
+	return best
+}
@@ -0,0 +1,44 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregations(t *testing.T) {
+	server := newTestServer(t, `{
+  orders: [
+    {id: 1, customer: "globex", status: "paid", total: 40, createdAt: "2024-03-01"}
+    {id: 2, customer: "acme", status: "paid", total: 30, createdAt: "2024-05-01"}
+    {id: 3, customer: "acme", status: "paid", total: 50, createdAt: "2024-04-01"}
+    {id: 4, status: "open", total: "n/a"}
+  ]
+}
+`)
+
+	tests := map[string]any{
+		"/orders?status=paid&_count&_sum=total&_avg=total&_max=createdAt": map[string]any{
+			"count": float64(3),
+			"sum":   map[string]any{"total": float64(120)},
+			"avg":   map[string]any{"total": float64(40)},
+			"max":   map[string]any{"createdAt": "2024-05-01"},
+		},
+		"/orders?status=open&_avg=total": map[string]any{
+			"count": float64(1),
+			"avg":   map[string]any{"total": nil},
+		},
+		"/orders?_groupBy=customer&_sum=total&sort=-total&limit=1": []any{
+			map[string]any{"customer": "acme", "count": float64(2), "sum": map[string]any{"total": float64(80)}},
+			map[string]any{"customer": "globex", "count": float64(1), "sum": map[string]any{"total": float64(40)}},
+			map[string]any{"customer": nil, "count": float64(1), "sum": map[string]any{"total": float64(0)}},
+		},
+	}
+
+	for path, want := range tests {
+		var got any
+
+		if getJSON(t, server.URL+path, &got); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
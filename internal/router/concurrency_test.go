@@ -0,0 +1,85 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentReadsAndWrites runs sorting and joining reads while items are added and patched.
+// Writes only copy the containers they change, so run it with -race to catch a write reaching
+// into a snapshot that readers still hold.
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	server := newTestServer(t, seedLibrary)
+
+	const rounds = 50
+
+	reads := []string{
+		"/books?sort=-title&_expand=author",
+		"/authors?sort=-name&_embed=books",
+		"/authors/1?_embed=books",
+		"/books?q=dune",
+		"/__search?q=le",
+		"/__openapi.json",
+	}
+
+	var wg sync.WaitGroup
+
+	for _, path := range reads {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range rounds {
+				if response, body := send(t, http.MethodGet, server.URL+path, nil, ""); response.StatusCode != http.StatusOK {
+					t.Errorf("GET %s: %d %s", path, response.StatusCode, body)
+					return
+				}
+			}
+		}()
+	}
+
+	writes := []struct {
+		method, path, contentType, body string
+	}{
+		{http.MethodPost, "/books", "application/json", `{"authorId": 1, "title": "Lathe %d"}`},
+		{http.MethodPatch, "/books/1", "application/json", `{"title": "The Dispossessed %d"}`},
+		{http.MethodPatch, "/authors/2", mergePatchMediaType, `{"name": "Herbert %d"}`},
+		{http.MethodPatch, "/books/2", jsonPatchMediaType, `[{"op": "replace", "path": "/title", "value": "Dune %d"}]`},
+	}
+
+	for _, write := range writes {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			header := http.Header{"Content-Type": {write.contentType}}
+
+			for i := range rounds {
+				response, body := send(t, write.method, server.URL+write.path, header, fmt.Sprintf(write.body, i))
+
+				if response.StatusCode >= 300 {
+					t.Errorf("%s %s: %d %s", write.method, write.path, response.StatusCode, body)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Every write landed exactly once
+	var books []map[string]any
+	getJSON(t, server.URL+"/books", &books)
+
+	if len(books) != 2+rounds {
+		t.Fatalf("got %d books, want %d", len(books), 2+rounds)
+	}
+
+	if title := books[0]["title"]; title != fmt.Sprintf("The Dispossessed %d", rounds-1) {
+		t.Fatalf("got title %v after the last patch", title)
+	}
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hson-server/internal/datatree"
+	"slices"
+)
+
+// ErrInvalidCursor is returned for cursors that were not produced by this server
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// paginateCursor sorts arr by the requested sort keys plus the primary key, then returns up to
+// opts.Limit items following the cursor position. Cursors hold the sort values of the last item
+// rather than its position, so inserts and deletes between pages never skip or repeat items.
+func paginateCursor(arr []any, opts QueryOptions) ([]any, string, error) {
+	// The primary key makes the order total, so every item has a unique position
+	keys := slices.Clone(opts.Sort)
+
+	for _, field := range opts.KeyFields {
+		keys = append(keys, SortKey{Field: field})
+	}
+
+	slices.SortStableFunc(arr, func(a, b any) int {
+		return compareItems(a, b, keys, opts)
+	})
+
+	// Skip everything up to and including the item the cursor was taken from
+	start := 0
+
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		start, _ = slices.BinarySearchFunc(arr, after, func(item any, target map[string]any) int {
+			if compareItems(item, target, keys, opts) <= 0 {
+				return -1
+			}
+			return 1
+		})
+	}
+
+	end := len(arr)
+
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+	}
+
+	page := arr[start:end]
+
+	// More items follow, so hand out a cursor pointing after the last one of this page
+	if end < len(arr) && len(page) > 0 {
+		return page, encodeCursor(page[len(page)-1], keys), nil
+	}
+
+	return page, "", nil
+}
+
+// encodeCursor captures the sort key values of item as an opaque URL-safe string
+func encodeCursor(item any, keys []SortKey) string {
+	values := make(map[string]any, len(keys))
+
+	for _, key := range keys {
+		// Missing values are left out so they keep sorting as missing
+		if value, ok := datatree.FieldValue(item, key.Field); ok {
+			values[key.Field] = value
+		}
+	}
+
+	encoded, _ := json.Marshal(values)
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeCursor turns a cursor back into a pseudo item that compares like the original item
+func decodeCursor(cursor string) (map[string]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var values map[string]any
+
+	if err := json.Unmarshal(raw, &values); err != nil || values == nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return values, nil
+}
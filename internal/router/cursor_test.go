@@ -0,0 +1,41 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestCursorPagination(t *testing.T) {
+	server := newTestServer(t, `{books: [{id: 1, year: 1965}, {id: 2, year: 1937}, {id: 3, year: 1965}, {id: 4, year: 1984}]}`)
+
+	var got []float64
+	cursor := ""
+
+	for range 3 {
+		var page []map[string]any
+		response := getJSON(t, server.URL+"/books?sort=-year&limit=2&cursor="+cursor, &page)
+
+		for _, book := range page {
+			got = append(got, book["id"].(float64))
+		}
+
+		// Inserting ahead of the cursor doesn't shift the following pages
+		if cursor == "" {
+			send(t, http.MethodPost, server.URL+"/books", nil, `{"id": 0, "year": 2000}`)
+		}
+
+		if cursor = response.Header.Get("X-Next-Cursor"); cursor == "" {
+			break
+		}
+	}
+
+	// Ties on year are broken by id
+	if want := []float64{4, 1, 3, 2}; !slices.Equal(got, want) {
+		t.Fatalf("paged through %v, want %v", got, want)
+	}
+
+	if response, _ := send(t, http.MethodGet, server.URL+"/books?limit=2&cursor=nope", nil, ""); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got %d for a malformed cursor, want 400", response.StatusCode)
+	}
+}
@@ -2,6 +2,7 @@ package router
 
 import (
 	"encoding/json"
+	"errors"
 	"hson-server/internal/datatree"
 	"hson-server/internal/logger"
 	"net/http"
@@ -27,8 +28,28 @@ func handleGetRequest(store HSONStore) http.HandlerFunc {
 
 		storeStart := time.Now()
 
-		// Get data from the store based on the path
-		data, readErr := store.Read(path)
+		// Take one snapshot of the whole data tree, so the resource, its relations and everything
+		// derived from them come from the same version even if a write lands mid-request
+		root, readErr := store.Read("/")
+
+		// Get data from the snapshot based on the path
+		data := root
+
+		if readErr == nil {
+			data, readErr = datatree.Lookup(root, path)
+		}
+
+		// Paths missing from the data tree may be relational routes e.g: /authors/1/books
+		queryPath := path
+
+		if errors.Is(readErr, datatree.ErrNotFound) {
+			if route, ok := resolveNestedRoute(root, path); ok {
+				children, childErr := datatree.Lookup(root, route.collection)
+				arr, _ := children.([]any)
+
+				data, readErr, queryPath = route.filter(arr), childErr, route.collection
+			}
+		}
 
 		// Get the number of items
 		dataCount := countItems(data)
@@ -51,10 +72,78 @@ func handleGetRequest(store HSONStore) http.HandlerFunc {
 		queryParams := request.URL.Query()
 
 		// Apply query params to filter results if provided
-		filteredData := applyQuery(data, queryParams)
+		filteredData, pageInfo, queryErr := applyQuery(data, root, queryPath, queryParams)
+
+		if queryErr != nil {
+			logger.Warn("Invalid query", "path", path, "query_params", request.URL.RawQuery, "err", queryErr)
+			http.Error(writer, queryErr.Error(), http.StatusBadRequest)
+			return
+		}
 
 		filteredDataCount := countItems(filteredData)
 
+		// Paginated collections report their total size and how to reach the other pages
+		if pageInfo != nil && pageInfo.Paginated {
+			writer.Header().Set("X-Total-Count", strconv.Itoa(pageInfo.Total))
+
+			if links := paginationLinks(request, *pageInfo); links != "" {
+				writer.Header().Set("Link", links)
+			}
+
+			if pageInfo.NextCursor != "" {
+				writer.Header().Set("X-Next-Cursor", pageInfo.NextCursor)
+			}
+		}
+
+		// Collections can be wrapped with their pagination metadata
+		body := filteredData
+
+		if pageInfo != nil && useEnvelope(queryParams) {
+			limit := pageInfo.Limit
+
+			if limit <= 0 {
+				limit = pageInfo.Total
+			}
+
+			envelope := map[string]any{
+				"data":  filteredData,
+				"total": pageInfo.Total,
+				"page":  pageInfo.Page(),
+				"limit": limit,
+			}
+
+			// Cursor pages report the way forward instead of a page number, null on the last page
+			if pageInfo.CursorMode {
+				delete(envelope, "page")
+				envelope["next_cursor"] = nil
+
+				if pageInfo.NextCursor != "" {
+					envelope["next_cursor"] = pageInfo.NextCursor
+				}
+			}
+
+			body = envelope
+		}
+
+		// Tag the representation so clients can revalidate it or make conditional writes
+		etag := datatree.ETag(body)
+
+		writer.Header().Set("ETag", etag)
+
+		// The client's copy is still current, no need to send it again
+		if inm := request.Header.Get("If-None-Match"); inm != "" && datatree.MatchETag(inm, etag, true) {
+			writer.WriteHeader(http.StatusNotModified)
+
+			logger.Info("GET request completed ✅",
+				"path", path,
+				"query_params", request.URL.RawQuery,
+				"status", http.StatusNotModified,
+				"etag", etag,
+				"request_duration", time.Since(start),
+			)
+			return
+		}
+
 		// Set Content type header to indiciate JSON response
 		writer.Header().Set("Content-Type", "application/json")
 
@@ -62,7 +151,7 @@ func handleGetRequest(store HSONStore) http.HandlerFunc {
 		status := http.StatusOK
 
 		// JSON encode the filtered data as JSON and write it to the response body for client.
-		if encodeErr := json.NewEncoder(writer).Encode(filteredData); encodeErr != nil {
+		if encodeErr := json.NewEncoder(writer).Encode(body); encodeErr != nil {
 			logger.Error(
 				"Failed to encode JSON response",
 				"filtered_count", filteredDataCount,
@@ -113,61 +202,71 @@ func handlePostRequest(store HSONStore) http.HandlerFunc {
 			return
 		}
 
-		storeStart := time.Now()
+		writeStart := time.Now()
 
-		// Read the existing resource/value at the given path
-		existingResource, readErr := store.Read(request.URL.Path)
+		// Paths missing from the data tree may be relational routes e.g: /authors/1/books
+		appendPath := request.URL.Path
+		route, nested := nestedRoute{}, false
 
-		existingCount := countItems(existingResource)
+		if _, err := store.Read(appendPath); errors.Is(err, datatree.ErrNotFound) {
+			root, _ := store.Read("/")
+			route, nested = resolveNestedRoute(root, appendPath)
+		}
 
-		logger.Debug(
-			"Store read/lookup result",
-			"data", existingResource,
-			"path", request.URL.Path,
-			"error", readErr,
-			"initial_count", existingCount,
-			"store_duration", time.Since(storeStart),
-		)
+		if nested {
+			obj, ok := newItem.(map[string]any)
 
-		if readErr != nil && readErr != datatree.ErrNotFound {
-			handleStoreError(writer, request, readErr, "Data lookup failed")
-			return
+			if !ok {
+				logger.Error("Cannot POST a non-object to a relational route", "path", request.URL.Path)
+				http.Error(writer, "relational routes only accept objects", http.StatusBadRequest)
+				return
+			}
+
+			// Pre-fill the foreign key and add the item to the related top-level collection
+			obj[route.foreignKey] = route.parentID
+			appendPath = route.collection
 		}
 
-		// Ensure the value of existingResource is an array
-		// If null, init a new array
-		arr, err := ensureArray(existingResource)
+		// Append the new item to the array at the URL path, assigning an id if the collection uses them
+		key, err := store.Append(appendPath, newItem)
 
-		if err != nil {
+		if errors.Is(err, datatree.ErrNotArray) {
 			logger.Error("Cannot POST to non-array endpoint, try PUT instead", "path", request.URL.Path, "err", err)
 			writer.Header().Set("Allow", "GET,PUT,DELETE")
-			http.Error(writer, err.Error(), http.StatusMethodNotAllowed)
+			http.Error(writer, "POST only allowed on array endpoints", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Append the new item to the array
-		arr = append(arr, newItem)
+		if err != nil {
+			handleStoreError(writer, request, err, "Append operation from store failed")
+			return
+		}
 
-		writeStart := time.Now()
+		// Read the updated array back to return it to the client
+		updated, readErr := store.Read(appendPath)
 
-		// Write the updated array back to the store at the URL path
-		if err := store.Write(request.URL.Path, arr); err != nil {
-			handleStoreError(writer, request, err, "Writing operation from store failed")
+		if readErr != nil {
+			handleStoreError(writer, request, readErr, "Data lookup failed")
 			return
 		}
 
+		arr, _ := updated.([]any)
+
+		// Relational routes return the related items only, like their GET does
+		if nested {
+			arr = route.filter(arr)
+		}
+
 		logger.Debug(
 			"Appended new item to array and persisted change",
 			"path", request.URL.Path,
+			"key", key,
 			"new_count", len(arr),
 			"write_duration", time.Since(writeStart),
 		)
 
-		// Get the index of the newly appended item
-		index := len(arr) - 1
-
-		// Construct location string using url path and new item index
-		location := path.Join(request.URL.Path, strconv.Itoa(index))
+		// Construct location string using the collection path and the new item's id or index
+		location := path.Join(appendPath, key)
 
 		// Set Content type header to indiciate JSON response
 		writer.Header().Set("Content-Type", "application/json")
@@ -227,7 +326,7 @@ func handlePutRequest(store HSONStore) http.HandlerFunc {
 		writeStart := time.Now()
 
 		// Write the updated value back to the store at the URL path
-		if err := store.Write(request.URL.Path, newValue); err != nil {
+		if err := store.Write(request.URL.Path, newValue, request.Header.Get("If-Match")); err != nil {
 			handleStoreError(writer, request, err, "Writing operation from store failed")
 			return
 		}
@@ -266,23 +365,59 @@ func handlePatchRequest(store HSONStore) http.HandlerFunc {
 			return
 		}
 
-		// Init variable for patch
-		var patch map[string]any
+		patchStart := time.Now()
 
-		// Decode JSON request body into patch variable
-		if err := decodeJSONBody(request, 1<<20, &patch); err != nil {
-			logger.Error("Invalid JSON body", "path", request.URL.Path, "err", err)
-			http.Error(writer, "invalid JSON", http.StatusBadRequest)
-			return
+		var patchErr error
+
+		if hasMediaType(request, jsonPatchMediaType) {
+			// Init variable for the RFC 6902 operation list
+			var ops []any
+
+			// Decode JSON request body into ops variable
+			if err := decodeJSONBody(request, 1<<20, &ops); err != nil {
+				logger.Error("Invalid JSON patch body", "path", request.URL.Path, "err", err)
+				http.Error(writer, "invalid JSON patch, expected an array of operations", http.StatusBadRequest)
+				return
+			}
+
+			logger.Debug("Decoded JSON patch operations", "path", request.URL.Path, "ops", ops)
+
+			// Apply all operations relative to the given path, or none if one of them fails
+			patchErr = store.JSONPatch(request.URL.Path, ops, request.Header.Get("If-Match"))
+		} else if hasMediaType(request, mergePatchMediaType) {
+			// Init variable for the merge patch, which may be any JSON value
+			var patch any
+
+			// Decode JSON request body into patch variable
+			if err := decodeJSONBody(request, 1<<20, &patch); err != nil {
+				logger.Error("Invalid JSON merge patch body", "path", request.URL.Path, "err", err)
+				http.Error(writer, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			logger.Debug("Decoded merge patch payload", "path", request.URL.Path, "patch", patch)
+
+			// Deep merge the patch into the value at the given path
+			patchErr = store.MergePatch(request.URL.Path, patch, request.Header.Get("If-Match"))
+		} else {
+			// Init variable for patch
+			var patch map[string]any
+
+			// Decode JSON request body into patch variable
+			if err := decodeJSONBody(request, 1<<20, &patch); err != nil {
+				logger.Error("Invalid JSON body", "path", request.URL.Path, "err", err)
+				http.Error(writer, "invalid JSON", http.StatusBadRequest)
+				return
+			}
+
+			logger.Debug("Decoded patch payload", "path", request.URL.Path, "patch", patch)
+
+			// Apply patch to the value at the given path
+			patchErr = store.Patch(request.URL.Path, patch, request.Header.Get("If-Match"))
 		}
 
-		logger.Debug("Decoded patch payload", "path", request.URL.Path, "patch", patch)
-
-		patchStart := time.Now()
-
-		// Apply patch to the value at the given path
-		if err := store.Patch(request.URL.Path, patch); err != nil {
-			handleStoreError(writer, request, err, "Patch operation from store failed")
+		if patchErr != nil {
+			handleStoreError(writer, request, patchErr, "Patch operation from store failed")
 			return
 		}
 
@@ -318,7 +453,7 @@ func handleDeleteRequest(store HSONStore) http.HandlerFunc {
 		storeStart := time.Now()
 
 		// Delete resource at Path + any potential filters & persist change
-		err := store.Delete(path, request.URL.Query())
+		err := store.Delete(path, request.URL.Query(), request.Header.Get("If-Match"))
 
 		logger.Debug("Store delete result",
 			"path", path,
@@ -341,3 +476,48 @@ func handleDeleteRequest(store HSONStore) http.HandlerFunc {
 		)
 	}
 }
+
+func handleSearchRequest(store HSONStore) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		// Search is read only
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", "GET")
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Get the search query e.g: /__search?q=hobbit => hobbit
+		query := request.URL.Query().Get("q")
+
+		if query == "" {
+			http.Error(writer, "missing search query, use ?q=term", http.StatusBadRequest)
+			return
+		}
+
+		// Get a snapshot of the whole data tree to search through
+		data, readErr := store.Read("/")
+
+		if readErr != nil {
+			handleStoreError(writer, request, readErr, "Lookup operation from store failed")
+			return
+		}
+
+		// Find matching elements in every collection along with their paths
+		hits := datatree.Search(data, query)
+
+		// Set Content type header to indiciate JSON response
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(hits); err != nil {
+			logger.Error("Failed to encode JSON response", "path", request.URL.Path, "error", err)
+		}
+
+		logger.Info("Search request completed ✅",
+			"query", query,
+			"hit_count", len(hits),
+			"request_duration", time.Since(start),
+		)
+	}
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestETagPreconditions(t *testing.T) {
+	server := newTestServer(t, seedLibrary)
+
+	response, _ := send(t, http.MethodGet, server.URL+"/books/1", nil, "")
+	etag := response.Header.Get("ETag")
+
+	if etag == "" {
+		t.Fatal("GET did not return an ETag")
+	}
+
+	// An unchanged representation is not sent again
+	if response, body := send(t, http.MethodGet, server.URL+"/books/1", http.Header{"If-None-Match": {etag}}, ""); response.StatusCode != http.StatusNotModified || body != "" {
+		t.Fatalf("got %d %q, want 304 without a body", response.StatusCode, body)
+	}
+
+	// Writes go through while the client's copy is current
+	if response, body := send(t, http.MethodPatch, server.URL+"/books/1", http.Header{"If-Match": {etag}}, `{"title": "Lathe"}`); response.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d %s, want 204", response.StatusCode, body)
+	}
+
+	// and are refused once it is stale
+	if response, _ := send(t, http.MethodPut, server.URL+"/books/1", http.Header{"If-Match": {etag}}, `{"id": 1}`); response.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("got %d, want 412", response.StatusCode)
+	}
+
+	if response, _ := send(t, http.MethodGet, server.URL+"/books/1", http.Header{"If-None-Match": {etag}}, ""); response.StatusCode != http.StatusOK {
+		t.Fatalf("got %d for a changed book, want 200", response.StatusCode)
+	}
+
+	if response, _ := send(t, http.MethodDelete, server.URL+"/books/2", http.Header{"If-Match": {"*"}}, ""); response.StatusCode >= 300 {
+		t.Fatalf("got %d for If-Match: *, want success", response.StatusCode)
+	}
+}
+
+func TestKeyConflicts(t *testing.T) {
+	server := newTestServer(t, seedLibrary)
+
+	var before []any
+	getJSON(t, server.URL+"/books", &before)
+
+	// Every write verb refuses to give a book the id of another one
+	writes := []struct {
+		method, contentType, body string
+	}{
+		{http.MethodPut, "application/json", `{"id": 2, "title": "Dune"}`},
+		{http.MethodPatch, "application/json", `{"id": 2}`},
+		{http.MethodPatch, "application/merge-patch+json", `{"id": 2}`},
+		{http.MethodPatch, "application/json-patch+json", `[{"op": "replace", "path": "/id", "value": 2}]`},
+	}
+
+	for _, write := range writes {
+		header := http.Header{"Content-Type": {write.contentType}}
+
+		if response, body := send(t, write.method, server.URL+"/books/1", header, write.body); response.StatusCode != http.StatusConflict {
+			t.Errorf("%s %s: got %d %s, want 409", write.method, write.contentType, response.StatusCode, body)
+		}
+	}
+
+	var after []any
+	getJSON(t, server.URL+"/books", &after)
+
+	if !reflect.DeepEqual(after, before) {
+		t.Fatalf("refused writes changed the books to %v", after)
+	}
+
+	// A new id nobody has yet is fine
+	if response, body := send(t, http.MethodPatch, server.URL+"/books/1", nil, `{"id": 3}`); response.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %d %s, want 204", response.StatusCode, body)
+	}
+}
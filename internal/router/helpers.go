@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"hson-server/internal/datatree"
 	"hson-server/internal/logger"
+	"hson-server/internal/schema"
+	"hson-server/internal/utils"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 func parseQuery(qs url.Values) QueryOptions {
@@ -17,39 +21,149 @@ func parseQuery(qs url.Values) QueryOptions {
 	for key, values := range qs {
 		v := values[0]
 		switch key {
+		case "q":
+			opts.Search = v
 		case "sort":
-			if v != "" {
-				opts.Desc = v[0] == '-'
-				if opts.Desc {
-					v = v[1:]
+			for _, field := range strings.Split(v, ",") {
+				field = strings.TrimSpace(field)
+				desc := strings.HasPrefix(field, "-")
+				field = strings.TrimPrefix(field, "-")
+				if field != "" {
+					opts.Sort = append(opts.Sort, SortKey{Field: field, Desc: desc})
 				}
-				opts.SortKey = v
 			}
+		case "nulls":
+			opts.NullsFirst = v == "first"
+		case "collation":
+			opts.Numeric = v == "numeric"
 		case "limit":
 			opts.Limit, _ = strconv.Atoi(v)
+			opts.Paginated = true
 		case "page":
-			if page, err := strconv.Atoi(v); err == nil && page > 0 && opts.Limit > 0 {
-				opts.Offset = (page - 1) * opts.Limit
-			}
+			opts.Page, _ = strconv.Atoi(v)
+			opts.Paginated = true
 		case "offset":
 			opts.Offset, _ = strconv.Atoi(v)
+			opts.Paginated = true
+		case "cursor", "after":
+			opts.Cursor = v
+			opts.CursorMode = true
+			opts.Paginated = true
+		case "_count":
+			opts.Aggregate.Count = true
+		case "_sum":
+			opts.Aggregate.Sum = splitFields(v)
+		case "_avg":
+			opts.Aggregate.Avg = splitFields(v)
+		case "_min":
+			opts.Aggregate.Min = splitFields(v)
+		case "_max":
+			opts.Aggregate.Max = splitFields(v)
+		case "_groupBy":
+			opts.Aggregate.GroupBy = strings.TrimSpace(v)
+		case "_envelope", "fields", "exclude", "_embed", "_expand":
+			// Response shape only, handled by applyQuery and the GET handler
 		default:
 			if v != "" {
 				opts.Filters[key] = v
 			}
 		}
 	}
+	// Pages are resolved once the limit is known, whatever the parameter order
+	if opts.Page > 0 && opts.Limit > 0 {
+		opts.Offset = (opts.Page - 1) * opts.Limit
+	}
 	return opts
 }
 
+// useEnvelope reports whether array responses should be wrapped as {data, total, page, limit},
+// the ?_envelope param overriding the --envelope server flag
+func useEnvelope(qs url.Values) bool {
+	if param := qs.Get("_envelope"); param != "" {
+		enabled, err := strconv.ParseBool(param)
+		return err == nil && enabled
+	}
+
+	return Envelope
+}
+
+// paginationLinks builds an RFC 8288 Link header value with first/prev/next/last pages,
+// keeping the request's other query params and its page or offset style
+func paginationLinks(r *http.Request, info PageInfo) string {
+	// Cursors only know the way forward
+	if info.CursorMode {
+		if info.NextCursor == "" {
+			return ""
+		}
+
+		qs := r.URL.Query()
+		qs.Del("after")
+		qs.Set("cursor", info.NextCursor)
+
+		return fmt.Sprintf("<%s?%s>; rel=%q", r.URL.Path, qs.Encode(), "next")
+	}
+
+	if info.Limit <= 0 {
+		return ""
+	}
+
+	lastOffset := 0
+	if info.Total > 0 {
+		lastOffset = (info.Total - 1) / info.Limit * info.Limit
+	}
+
+	link := func(offset int, rel string) string {
+		qs := r.URL.Query()
+
+		if qs.Has("page") || !qs.Has("offset") {
+			qs.Del("offset")
+			qs.Set("page", strconv.Itoa(offset/info.Limit+1))
+		} else {
+			qs.Set("offset", strconv.Itoa(offset))
+		}
+
+		return fmt.Sprintf("<%s?%s>; rel=%q", r.URL.Path, qs.Encode(), rel)
+	}
+
+	links := []string{link(0, "first")}
+
+	if info.Offset > 0 {
+		links = append(links, link(max(info.Offset-info.Limit, 0), "prev"))
+	}
+
+	if info.Offset+info.Limit < info.Total {
+		links = append(links, link(info.Offset+info.Limit, "next"))
+	}
+
+	links = append(links, link(lastOffset, "last"))
+
+	return strings.Join(links, ", ")
+}
+
 func validateJSONContentType(r *http.Request) error {
-	if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, "application/json") {
+	// Accept application/json along with structured +json types like application/merge-patch+json
+	if ct := r.Header.Get("Content-Type"); !strings.Contains(ct, "application/json") && !strings.Contains(ct, "+json") {
 		return fmt.Errorf("Content-Type must be application/json")
 	}
 
 	return nil
 }
 
+const (
+	// jsonPatchMediaType marks a PATCH body as an RFC 6902 operation list instead of a merge object
+	jsonPatchMediaType = "application/json-patch+json"
+
+	// mergePatchMediaType marks a PATCH body as an RFC 7396 merge patch (deep merge, null deletes)
+	mergePatchMediaType = "application/merge-patch+json"
+)
+
+// hasMediaType reports whether the request body is of the given media type, ignoring parameters
+func hasMediaType(r *http.Request, mediaType string) bool {
+	parsed, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	return err == nil && parsed == mediaType
+}
+
 func decodeJSONBody(request *http.Request, limit int64, dst any) error {
 	// Limit the size of the request body
 	request.Body = http.MaxBytesReader(nil, request.Body, limit)
@@ -58,22 +172,17 @@ func decodeJSONBody(request *http.Request, limit int64, dst any) error {
 	return json.NewDecoder(request.Body).Decode(dst)
 }
 
-func ensureArray(resource any) ([]any, error) {
-	switch v := resource.(type) {
-	case []any:
-		return v, nil
-	case nil:
+func handleStoreError(w http.ResponseWriter, r *http.Request, err error, context string) {
+	if errors.Is(err, utils.ErrSnapshotNotFound) {
 		logger.Warn(
-			"Resource was nil; initializing empty array",
+			context+": snapshot not found",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
 		)
-		return []any{}, nil
-	default:
-		return nil, fmt.Errorf("POST only allowed on array endpoints")
-	}
-}
 
-func handleStoreError(w http.ResponseWriter, r *http.Request, err error, context string) {
-	if errors.Is(err, datatree.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else if errors.Is(err, datatree.ErrNotFound) {
 		logger.Error(
 			context+": resource not found",
 			"method", r.Method,
@@ -83,6 +192,103 @@ func handleStoreError(w http.ResponseWriter, r *http.Request, err error, context
 		)
 
 		http.NotFound(w, r)
+	} else if errors.Is(err, datatree.ErrConflict) {
+		logger.Warn(
+			context+": conflict",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
+		)
+
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else if errors.Is(err, datatree.ErrTestFailed) {
+		logger.Warn(
+			context+": JSON patch test failed, no changes applied",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
+		)
+
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else if errors.Is(err, datatree.ErrInvalidPatch) {
+		logger.Warn(
+			context+": JSON patch cannot be applied, no changes applied",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
+		)
+
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	} else if validationErr := (*schema.ValidationError)(nil); errors.As(err, &validationErr) {
+		logger.Warn(
+			context+": schema validation failed, no changes applied",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"violations", len(validationErr.Violations),
+			"err", err,
+		)
+
+		// Respond with the list of violations so clients can point at the offending fields
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":      schema.ErrInvalid.Error(),
+			"violations": validationErr.Violations,
+		})
+	} else if errors.Is(err, schema.ErrInvalidSchema) {
+		logger.Warn(
+			context+": schema definition rejected, no changes applied",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
+		)
+
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	} else if errors.Is(err, datatree.ErrMissingKey) {
+		logger.Warn(
+			context+": missing primary key",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
+		)
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	} else if errors.Is(err, utils.ErrPrecondition) {
+		logger.Warn(
+			context+": precondition failed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"if_match", r.Header.Get("If-Match"),
+		)
+
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	} else if errors.Is(err, utils.ErrNothingToUndo) || errors.Is(err, utils.ErrNothingToRedo) {
+		logger.Warn(
+			context+": history is empty",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
+		)
+
+		http.Error(w, err.Error(), http.StatusConflict)
+	} else if errors.Is(err, utils.ErrPersist) {
+		logger.Error(
+			context+": persisting data file failed, change was rolled back",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"query_params", r.URL.RawQuery,
+			"err", err,
+		)
+
+		// Report a full disk as insufficient storage, anything else as a server error
+		status := http.StatusInternalServerError
+
+		if errors.Is(err, syscall.ENOSPC) {
+			status = http.StatusInsufficientStorage
+		}
+
+		http.Error(w, err.Error(), status)
 	} else {
 		logger.Error(
 			context+": internal error",
@@ -0,0 +1,604 @@
+package router
+
+import (
+	"encoding/json"
+	"hson-server/internal/datatree"
+	"hson-server/internal/logger"
+	"hson-server/internal/schema"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryParameters are the collection GET params understood by parseQuery, applyQuery and the
+// GET handler. Field filters like ?author=tolkien are added per collection from its items.
+var queryParameters = []struct {
+	name, description, kind string
+}{
+	{"q", "Full-text search, every term must appear in some string field", "string"},
+	{"sort", "Comma separated fields to sort by, prefix a field with - for descending order e.g: author,-year", "string"},
+	{"nulls", "Place missing and null sort values first or last (default)", "string"},
+	{"collation", "Use numeric to sort digit runs by value e.g: item2 before item10", "string"},
+	{"limit", "Maximum number of items to return", "integer"},
+	{"page", "1-indexed page of limit items", "integer"},
+	{"offset", "Number of items to skip", "integer"},
+	{"cursor", "Opaque cursor from X-Next-Cursor, resumes after the item it was taken from", "string"},
+	{"after", "Alias for cursor", "string"},
+	{"_count", "Return the number of matching items", "boolean"},
+	{"_sum", "Comma separated numeric fields to sum", "string"},
+	{"_avg", "Comma separated numeric fields to average", "string"},
+	{"_min", "Comma separated fields to find the minimum of", "string"},
+	{"_max", "Comma separated fields to find the maximum of", "string"},
+	{"_groupBy", "Field to group aggregations by", "string"},
+	{"_envelope", "Wrap the items as {data, total, page, limit}, overriding --envelope", "boolean"},
+	{"fields", "Comma separated fields to keep in each item", "string"},
+	{"exclude", "Comma separated fields to drop from each item", "string"},
+	{"_embed", "Comma separated child collections to join into each item, dotted to follow further", "string"},
+	{"_expand", "Comma separated parents to join into each item, dotted to follow further", "string"},
+	{"delay", "Wait this Go duration before responding e.g: 500ms, capped at 1m", "string"},
+}
+
+// filterSuffixes are the operator suffixes accepted after a field filter, e.g: ?year_gte=1950
+var filterSuffixes = []string{
+	datatree.FilterNe, datatree.FilterGt, datatree.FilterGte, datatree.FilterLt, datatree.FilterLte,
+	datatree.FilterLike, datatree.FilterIn, datatree.FilterNin, datatree.FilterExists,
+}
+
+// componentNameUnsafe matches characters OpenAPI doesn't allow in component names
+var componentNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+func handleOpenAPIRequest(store HSONStore) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+
+		// The document is read only
+		if request.Method != http.MethodGet {
+			writer.Header().Set("Allow", "GET")
+			http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Get a snapshot of the whole data tree to infer the routes and schemas from
+		data, readErr := store.Read("/")
+
+		if readErr != nil {
+			handleStoreError(writer, request, readErr, "Lookup operation from store failed")
+			return
+		}
+
+		document := openAPIDocument(data)
+
+		// Set Content type header to indiciate JSON response
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(document); err != nil {
+			logger.Error("Failed to encode JSON response", "path", request.URL.Path, "error", err)
+		}
+
+		logger.Info("OpenAPI request completed ✅",
+			"path_count", len(document["paths"].(map[string]any)),
+			"request_duration", time.Since(start),
+		)
+	}
+}
+
+// openAPI collects the paths and component schemas of the document while walking the data tree
+type openAPI struct {
+	root       any
+	paths      map[string]any
+	components map[string]any
+}
+
+// openAPIDocument describes every route served for the data tree as an OpenAPI 3.1 document,
+// with schemas inferred from the current data. Values nested in array items, e.g: the books of
+// an author at /authors/1/books, are served but only described by the schema of the item route:
+// their own routes would need a path parameter for every array above them.
+func openAPIDocument(root any) map[string]any {
+	doc := &openAPI{root: root, paths: map[string]any{}, components: map[string]any{}}
+
+	doc.describe(nil, root)
+
+	// The built-in routes are served whatever the data looks like
+	maps.Copy(doc.paths, builtinPaths())
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "HSON Server",
+			"description": "Generated from the current data, so it changes along with it.",
+			"version":     strings.Trim(datatree.ETag(root), `"`),
+		},
+		"paths":      doc.paths,
+		"components": map[string]any{"schemas": doc.components},
+	}
+}
+
+// builtinPaths describes the search, OpenAPI and admin routes
+func builtinPaths() map[string]any {
+	snapshotParam := pathParameter("name", "Name the snapshot was saved under", map[string]any{"type": "string"})
+	scopeParam := queryParameter("path", "Only restore the value at this path e.g: /books, everything by default", "string", false)
+
+	return map[string]any{
+		"/__search": map[string]any{
+			"get": operation("Search every collection", "__search",
+				[]any{queryParameter("q", "Terms that must all appear in some string field of a hit", "string", true)},
+				map[string]any{
+					"200": jsonResponse("Matching items with the collection they belong to", map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"path":       map[string]any{"type": "string"},
+								"collection": map[string]any{"type": "string"},
+								"item":       map[string]any{},
+							},
+						},
+					}),
+					"400": textResponse("Missing search query"),
+				}),
+		},
+		"/__openapi.json": map[string]any{
+			"get": operation("This document, generated from the current data", "__openapi", nil, map[string]any{
+				"200": jsonResponse("OpenAPI 3.1 document", map[string]any{"type": "object"}),
+			}),
+		},
+		"/__admin/history": map[string]any{
+			"get": operation("List the changes that can be undone and redone, newest first", "__admin", nil, map[string]any{
+				"200": jsonResponse("The undo and redo lists", map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"undo": map[string]any{"type": "array", "items": changeSchema()},
+						"redo": map[string]any{"type": "array", "items": changeSchema()},
+					},
+				}),
+			}),
+		},
+		"/__admin/undo": map[string]any{
+			"post": revertOperation("Revert the latest change", "Nothing to undo"),
+		},
+		"/__admin/redo": map[string]any{
+			"post": revertOperation("Apply the latest undone change again", "Nothing to redo"),
+		},
+		"/__admin/snapshots": map[string]any{
+			"get": operation("List the saved snapshots", "__admin", nil, map[string]any{
+				"200": jsonResponse("The snapshots by name", map[string]any{
+					"type": "array",
+					"items": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"name":  map[string]any{"type": "string"},
+							"saved": map[string]any{"type": "string", "format": "date-time"},
+						},
+					},
+				}),
+			}),
+		},
+		"/__admin/snapshots/{name}": map[string]any{
+			"post": operation("Save the current data, replacing any snapshot of that name", "__admin", []any{snapshotParam}, map[string]any{
+				"201": map[string]any{"description": "Saved"},
+			}),
+			"delete": operation("Delete a snapshot", "__admin", []any{snapshotParam}, map[string]any{
+				"204": map[string]any{"description": "Deleted"},
+				"404": textResponse("No snapshot of that name"),
+			}),
+		},
+		"/__admin/snapshots/{name}/restore": map[string]any{
+			"post": restoreOperation("Restore the data saved in a snapshot", []any{snapshotParam, scopeParam}, map[string]any{
+				"404": textResponse("No snapshot of that name"),
+			}),
+		},
+		"/__admin/reset": map[string]any{
+			"post": restoreOperation("Restore the data as it was loaded at startup or by the last live reload", []any{scopeParam}, nil),
+		},
+	}
+}
+
+// changeSchema describes a recorded change, as listed by the history and returned by undo / redo
+func changeSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"verb":    map[string]any{"type": "string"},
+			"path":    map[string]any{"type": "string"},
+			"value":   map[string]any{},
+			"filters": map[string]any{"type": "object"},
+			"key":     map[string]any{"type": "string"},
+			"time":    map[string]any{"type": "string", "format": "date-time"},
+		},
+	}
+}
+
+func revertOperation(summary, nothingLeft string) map[string]any {
+	return operation(summary, "__admin", nil, map[string]any{
+		"200": jsonResponse("The change that was reverted or applied again", changeSchema()),
+		"409": textResponse(nothingLeft),
+		"422": validationResponse("The reverted data breaks a JSON Schema"),
+	})
+}
+
+func restoreOperation(summary string, params []any, responses map[string]any) map[string]any {
+	defaults := map[string]any{
+		"204": map[string]any{"description": "Restored"},
+		"422": validationResponse("The restored data breaks a JSON Schema"),
+	}
+
+	maps.Copy(defaults, responses)
+
+	return operation(summary, "__admin", params, defaults)
+}
+
+// describe adds the routes of the value at parts, then those of its children, and returns the
+// schema of the value. Arrays are described as collections and their items are not walked any further.
+func (doc *openAPI) describe(parts []string, value any) map[string]any {
+	urlPath := "/" + strings.Join(parts, "/")
+	tag := "/"
+
+	if len(parts) > 0 {
+		tag = parts[0]
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		// Objects reference the schemas of their children instead of repeating them
+		properties := map[string]any{}
+
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			// The $schema section configures validation, it isn't part of the API
+			if len(parts) == 0 && key == schema.SectionKey {
+				continue
+			}
+
+			properties[key] = doc.describe(append(slices.Clone(parts), key), v[key])
+		}
+
+		valueRef := doc.component(parts, map[string]any{
+			"type":       "object",
+			"properties": properties,
+			"required":   slices.Sorted(maps.Keys(properties)),
+		})
+
+		doc.paths[urlPath] = map[string]any{
+			"get":   readOperation("Read "+urlPath, tag, valueRef, itemParameters()),
+			"put":   writeOperation("Replace "+urlPath, tag, valueRef),
+			"patch": patchOperation("Update fields of "+urlPath, tag),
+		}
+
+		if len(parts) > 0 {
+			doc.paths[urlPath].(map[string]any)["delete"] = deleteOperation("Delete "+urlPath, tag, nil)
+		}
+
+		return valueRef
+
+	case []any:
+		return doc.describeCollection(parts, v)
+
+	default:
+		valueSchema := schema.Infer(v)
+
+		doc.paths[urlPath] = map[string]any{
+			"get":    readOperation("Read "+urlPath, tag, valueSchema, nil),
+			"put":    writeOperation("Replace "+urlPath, tag, valueSchema),
+			"delete": deleteOperation("Delete "+urlPath, tag, nil),
+		}
+
+		return valueSchema
+	}
+}
+
+// describeCollection adds the collection route, its item route and its relational routes
+func (doc *openAPI) describeCollection(parts []string, items []any) map[string]any {
+	urlPath := "/" + strings.Join(parts, "/")
+	tag := parts[0]
+
+	itemSchema := schema.Infer(items)["items"].(map[string]any)
+	itemRef := doc.component(parts, itemSchema)
+	collectionSchema := map[string]any{"type": "array", "items": itemRef}
+
+	// Collection route e.g: /books
+	doc.paths[urlPath] = map[string]any{
+		"get":    readOperation("List "+urlPath, tag, collectionResponse(itemRef), collectionParameters(itemSchema)),
+		"post":   createOperation("Add an item to "+urlPath, tag, itemRef, nil),
+		"put":    writeOperation("Replace "+urlPath, tag, collectionSchema),
+		"delete": deleteOperation("Delete the items of "+urlPath+" matching the filters, or all of them", tag, filterParameters(itemSchema)),
+	}
+
+	// Item route e.g: /books/{id}
+	keyParam := doc.keyParameter(parts, itemSchema)
+	itemPath := urlPath + "/{" + keyParam["name"].(string) + "}"
+	pathParams := []any{keyParam}
+
+	doc.paths[itemPath] = map[string]any{
+		"get":    readOperation("Read an item of "+urlPath, tag, itemRef, append(slices.Clone(pathParams), itemParameters()...)),
+		"put":    writeOperation("Replace an item of "+urlPath, tag, itemRef, pathParams...),
+		"patch":  patchOperation("Update fields of an item of "+urlPath, tag, pathParams...),
+		"delete": deleteOperation("Delete an item of "+urlPath, tag, pathParams),
+	}
+
+	// Relational routes e.g: /authors/{authorId}/books for sibling collections referencing an item
+	if len(datatree.KeyFields(parts)) != 1 {
+		return collectionSchema
+	}
+
+	container, _ := datatree.Lookup(doc.root, strings.Join(parts[:len(parts)-1], "/"))
+	siblings, _ := container.(map[string]any)
+
+	foreignKey := foreignKeyName(singular(parts[len(parts)-1]))
+
+	for _, childName := range slices.Sorted(maps.Keys(siblings)) {
+		children, ok := siblings[childName].([]any)
+
+		if !ok || childName == parts[len(parts)-1] {
+			continue
+		}
+
+		childSchema := schema.Infer(children)["items"].(map[string]any)
+		childProperties, _ := childSchema["properties"].(map[string]any)
+
+		if _, ok := childProperties[foreignKey]; !ok {
+			continue
+		}
+
+		childRef := doc.component(append(slices.Clone(parts[:len(parts)-1]), childName), childSchema)
+		parentParam := pathParameter(foreignKey, "Key of the "+singular(parts[len(parts)-1])+" the items reference", keyParam["schema"])
+		relationPath := urlPath + "/{" + foreignKey + "}/" + childName
+
+		doc.paths[relationPath] = map[string]any{
+			"get": readOperation("List the "+childName+" of an item of "+urlPath, tag, collectionResponse(childRef),
+				append([]any{parentParam}, collectionParameters(childSchema)...)),
+			"post": createOperation("Add an item to "+childName+" referencing an item of "+urlPath, tag, childRef, []any{parentParam}),
+		}
+	}
+
+	return collectionSchema
+}
+
+// component registers a schema under components/schemas and returns a reference to it
+func (doc *openAPI) component(parts []string, valueSchema map[string]any) map[string]any {
+	name := "root"
+
+	if len(parts) > 0 {
+		name = componentNameUnsafe.ReplaceAllString(strings.Join(parts, "."), "_")
+	}
+
+	doc.components[name] = valueSchema
+
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// keyParameter describes the path segment addressing an item: its primary key when the items
+// have one, otherwise its positional index
+func (doc *openAPI) keyParameter(parts []string, itemSchema map[string]any) map[string]any {
+	fields := datatree.KeyFields(parts)
+	properties, _ := itemSchema["properties"].(map[string]any)
+
+	if len(fields) > 1 {
+		return pathParameter("key", "Composite key, the values of "+strings.Join(fields, ", ")+" joined by "+strconv.Quote(datatree.KeySeparator),
+			map[string]any{"type": "string"})
+	}
+
+	if keySchema, ok := properties[fields[0]]; ok {
+		return pathParameter(fields[0], "Primary key of the item", keySchema)
+	}
+
+	// Items POSTed to an empty collection get generated keys, numbers or strings depending on --id-strategy
+	if len(itemSchema) == 0 {
+		return pathParameter(fields[0], "Primary key of the item", map[string]any{"type": []string{"integer", "string"}})
+	}
+
+	return pathParameter("index", "Position of the item in the collection", map[string]any{"type": "integer", "minimum": 0})
+}
+
+// collectionParameters are the query params of a collection GET, field filters included
+func collectionParameters(itemSchema map[string]any) []any {
+	params := []any{}
+
+	for _, param := range queryParameters {
+		params = append(params, queryParameter(param.name, param.description, param.kind, false))
+	}
+
+	return append(params, filterParameters(itemSchema)...)
+}
+
+// filterParameters are the field filters of a collection, one per scalar field of its items
+func filterParameters(itemSchema map[string]any) []any {
+	properties, _ := itemSchema["properties"].(map[string]any)
+	params := []any{}
+
+	for _, field := range slices.Sorted(maps.Keys(properties)) {
+		switch properties[field].(map[string]any)["type"] {
+		case "object", "array", nil:
+			continue
+		}
+
+		// Filters are matched as strings, whatever the field's type
+		params = append(params, queryParameter(field,
+			"Filter by "+field+", suffix the name with "+strings.Join(filterSuffixes, ", ")+" for other comparisons",
+			"string", false))
+	}
+
+	return params
+}
+
+// itemParameters are the query params that also apply to a single resource
+func itemParameters() []any {
+	params := []any{}
+
+	for _, param := range queryParameters {
+		switch param.name {
+		case "fields", "exclude", "_embed", "_expand", "delay":
+			params = append(params, queryParameter(param.name, param.description, param.kind, false))
+		}
+	}
+
+	return params
+}
+
+func queryParameter(name, description, kind string, required bool) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"required":    required,
+		"schema":      map[string]any{"type": kind},
+	}
+}
+
+func pathParameter(name, description string, paramSchema any) map[string]any {
+	return map[string]any{
+		"name":        name,
+		"in":          "path",
+		"description": description,
+		"required":    true,
+		"schema":      paramSchema,
+	}
+}
+
+// collectionResponse is the body of a collection GET, enveloped when --envelope is set
+func collectionResponse(itemRef map[string]any) map[string]any {
+	items := map[string]any{"type": "array", "items": itemRef}
+
+	if !Envelope {
+		return items
+	}
+
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"data":        items,
+			"total":       map[string]any{"type": "integer"},
+			"page":        map[string]any{"type": "integer"},
+			"limit":       map[string]any{"type": "integer"},
+			"next_cursor": map[string]any{"type": []string{"string", "null"}},
+		},
+	}
+}
+
+func readOperation(summary, tag string, bodySchema map[string]any, params []any) map[string]any {
+	ok := jsonResponse("The current value", bodySchema)
+	ok["headers"] = map[string]any{
+		"ETag":          map[string]any{"schema": map[string]any{"type": "string"}},
+		"X-Total-Count": map[string]any{"schema": map[string]any{"type": "integer"}},
+		"Link":          map[string]any{"schema": map[string]any{"type": "string"}},
+		"X-Next-Cursor": map[string]any{"schema": map[string]any{"type": "string"}},
+	}
+
+	return operation(summary, tag, params, map[string]any{
+		"200": ok,
+		"304": map[string]any{"description": "Not modified since the If-None-Match ETag"},
+		"400": textResponse("Invalid query"),
+		"404": textResponse("Not found"),
+	})
+}
+
+func createOperation(summary, tag string, itemRef map[string]any, params []any) map[string]any {
+	// The response lists the whole collection (or the items of the parent) with the new item, its
+	// own URL is in the Location header
+	created := jsonResponse("The items of the collection, the new one with its generated key included",
+		map[string]any{"type": "array", "items": itemRef})
+	created["headers"] = map[string]any{"Location": map[string]any{"schema": map[string]any{"type": "string"}}}
+
+	op := operation(summary, tag, params, writeResponses(map[string]any{
+		"201": created,
+		"409": textResponse("An item with this key already exists"),
+	}))
+	op["requestBody"] = jsonBody(itemRef)
+
+	return op
+}
+
+func writeOperation(summary, tag string, bodySchema map[string]any, params ...any) map[string]any {
+	op := operation(summary, tag, params, writeResponses(map[string]any{}))
+	op["requestBody"] = jsonBody(bodySchema)
+
+	return op
+}
+
+func patchOperation(summary, tag string, params ...any) map[string]any {
+	op := operation(summary, tag, params, writeResponses(map[string]any{
+		"409": textResponse("A JSON Patch test operation failed"),
+	}))
+	op["requestBody"] = map[string]any{
+		"required": true,
+		"content": map[string]any{
+			"application/json":  map[string]any{"schema": map[string]any{"type": "object"}},
+			mergePatchMediaType: map[string]any{"schema": map[string]any{}},
+			jsonPatchMediaType:  map[string]any{"schema": map[string]any{"type": "array", "items": map[string]any{"type": "object"}}},
+		},
+	}
+
+	return op
+}
+
+func deleteOperation(summary, tag string, params []any) map[string]any {
+	return operation(summary, tag, params, writeResponses(map[string]any{}))
+}
+
+func operation(summary, tag string, params []any, responses map[string]any) map[string]any {
+	op := map[string]any{
+		"summary":   summary,
+		"tags":      []string{tag},
+		"responses": responses,
+	}
+
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	return op
+}
+
+// writeResponses adds the responses every write may fail with
+func writeResponses(responses map[string]any) map[string]any {
+	defaults := map[string]any{
+		"204": map[string]any{"description": "Changed"},
+		"400": textResponse("Invalid request body"),
+		"404": textResponse("Not found"),
+		"412": textResponse("The If-Match ETag no longer matches"),
+		"422": validationResponse("The change breaks a JSON Schema"),
+	}
+
+	// Operations creating items respond with 201 instead of 204
+	if _, ok := responses["201"]; ok {
+		delete(defaults, "204")
+	}
+
+	maps.Copy(defaults, responses)
+
+	return defaults
+}
+
+// validationResponse is the body of a write rejected by a JSON Schema
+func validationResponse(description string) map[string]any {
+	return jsonResponse(description, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"error":      map[string]any{"type": "string"},
+			"violations": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+		},
+	})
+}
+
+func jsonBody(bodySchema map[string]any) map[string]any {
+	return map[string]any{
+		"required": true,
+		"content":  map[string]any{"application/json": map[string]any{"schema": bodySchema}},
+	}
+}
+
+func jsonResponse(description string, bodySchema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     map[string]any{"application/json": map[string]any{"schema": bodySchema}},
+	}
+}
+
+func textResponse(description string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}},
+	}
+}
@@ -0,0 +1,101 @@
+package router
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	server := newTestServer(t, seedLibrary)
+
+	var doc struct {
+		OpenAPI    string
+		Paths      map[string]map[string]any
+		Components struct{ Schemas map[string]any }
+	}
+
+	getJSON(t, server.URL+"/__openapi.json", &doc)
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Fatalf("got version %q", doc.OpenAPI)
+	}
+
+	// Collections, their items and their relational routes are described
+	routes := map[string][]string{
+		"/books":                    {"get", "post", "delete"},
+		"/books/{id}":               {"get", "put", "patch", "delete"},
+		"/authors/{authorId}/books": {"get", "post"},
+		"/__search":                 {"get"},
+	}
+
+	for path, methods := range routes {
+		for _, method := range methods {
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Errorf("%s %s is missing", method, path)
+			}
+		}
+	}
+
+	if _, ok := doc.Components.Schemas["books"]; !ok {
+		t.Errorf("no component schema for books in %v", doc.Components.Schemas)
+	}
+}
+
+func TestOpenAPIBuiltinRoutes(t *testing.T) {
+	root := map[string]any{
+		"authors": []any{map[string]any{"id": float64(1), "name": "Le Guin"}},
+		"books":   []any{map[string]any{"id": float64(1), "authorId": float64(1), "title": "The Dispossessed"}},
+	}
+
+	paths := openAPIDocument(root)["paths"].(map[string]any)
+
+	// The built-in routes are listed along with the ones of the data
+	for _, path := range []string{
+		"/__search", "/__openapi.json", "/__admin/history", "/__admin/undo", "/__admin/redo",
+		"/__admin/snapshots", "/__admin/snapshots/{name}", "/__admin/snapshots/{name}/restore", "/__admin/reset",
+	} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("%s is missing", path)
+		}
+	}
+
+	// POST responds with the items of the collection, not just the new one
+	for path, component := range map[string]string{"/books": "books", "/authors/{authorId}/books": "books"} {
+		created := paths[path].(map[string]any)["post"].(map[string]any)["responses"].(map[string]any)["201"].(map[string]any)
+		got := created["content"].(map[string]any)["application/json"].(map[string]any)["schema"]
+		want := map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/" + component}}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("POST %s responds with %v, want %v", path, got, want)
+		}
+	}
+}
+
+// TestOpenAPINestedInItems pins that values nested in array items get no routes of their own,
+// only the schema of the item route describes them
+func TestOpenAPINestedInItems(t *testing.T) {
+	root := map[string]any{
+		"authors": []any{map[string]any{"id": float64(1), "books": []any{map[string]any{"id": float64(1), "title": "Dune"}}}},
+	}
+
+	doc := openAPIDocument(root)
+	paths := doc["paths"].(map[string]any)
+
+	for path := range paths {
+		if strings.HasPrefix(path, "/authors/{id}/") {
+			t.Errorf("got a route %s inside the authors' items", path)
+		}
+	}
+
+	if _, ok := paths["/authors/{id}"]; !ok {
+		t.Fatal("/authors/{id} is missing")
+	}
+
+	author := doc["components"].(map[string]any)["schemas"].(map[string]any)["authors"].(map[string]any)
+	books, _ := author["properties"].(map[string]any)["books"].(map[string]any)
+
+	if books["type"] != "array" {
+		t.Fatalf("the authors' schema describes books as %v", books)
+	}
+}
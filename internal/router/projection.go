@@ -0,0 +1,125 @@
+package router
+
+import (
+	"net/url"
+	"strings"
+)
+
+// projection keeps only the listed field paths of objects (fields=) or drops them (exclude=)
+type projection struct {
+	fields  [][]string
+	exclude [][]string
+}
+
+// parseProjection reads ?fields=id,title,author.name and ?exclude=internal into field paths
+func parseProjection(qs url.Values) projection {
+	return projection{
+		fields:  splitFieldPaths(qs.Get("fields")),
+		exclude: splitFieldPaths(qs.Get("exclude")),
+	}
+}
+
+func splitFieldPaths(list string) [][]string {
+	var paths [][]string
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			paths = append(paths, strings.Split(field, "."))
+		}
+	}
+	return paths
+}
+
+// apply projects a single resource, or every element of a collection, without touching the
+// stored data: projected objects are always new maps
+func (p projection) apply(value any) any {
+	if len(p.fields) == 0 && len(p.exclude) == 0 {
+		return value
+	}
+
+	if arr, ok := value.([]any); ok {
+		out := make([]any, len(arr))
+		for i, item := range arr {
+			out[i] = p.apply(item)
+		}
+		return out
+	}
+
+	if len(p.fields) > 0 {
+		value = pickFields(value, p.fields)
+	}
+	for _, path := range p.exclude {
+		value = dropField(value, path)
+	}
+	return value
+}
+
+// pickFields copies only the given field paths of value. Paths crossing an array are applied to
+// each of its elements, e.g: comments.author keeps the author of every comment.
+func pickFields(value any, paths [][]string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		// Group the remaining path tails by their first segment
+		children := map[string][][]string{}
+		whole := map[string]bool{}
+		for _, path := range paths {
+			if len(path) == 1 {
+				whole[path[0]] = true
+			} else {
+				children[path[0]] = append(children[path[0]], path[1:])
+			}
+		}
+
+		out := make(map[string]any, len(whole)+len(children))
+		for key, child := range v {
+			if whole[key] {
+				out[key] = child
+			} else if tails, ok := children[key]; ok {
+				out[key] = pickFields(child, tails)
+			}
+		}
+		return out
+
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = pickFields(item, paths)
+		}
+		return out
+
+	default:
+		return value
+	}
+}
+
+// dropField returns value without the field at path, copying only the containers along the path
+func dropField(value any, path []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		child, ok := v[path[0]]
+		if !ok {
+			return value
+		}
+
+		out := make(map[string]any, len(v))
+		for key, val := range v {
+			out[key] = val
+		}
+
+		if len(path) == 1 {
+			delete(out, path[0])
+		} else {
+			out[path[0]] = dropField(child, path[1:])
+		}
+		return out
+
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = dropField(item, path)
+		}
+		return out
+
+	default:
+		return value
+	}
+}
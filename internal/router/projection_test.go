@@ -0,0 +1,43 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProjection(t *testing.T) {
+	server := newTestServer(t, `{
+  books: [
+    {id: 1, title: "Dune", internal: "x", author: {name: "Herbert", email: "f@h"}, comments: [{author: "ann", text: "great"}]}
+  ]
+}
+`)
+
+	tests := map[string]any{
+		"/books?fields=id,author.name": []any{
+			map[string]any{"id": float64(1), "author": map[string]any{"name": "Herbert"}},
+		},
+		"/books/1?exclude=internal,author.email,comments": map[string]any{
+			"id": float64(1), "title": "Dune", "author": map[string]any{"name": "Herbert"},
+		},
+		// Paths crossing an array apply to each element
+		"/books/1?fields=comments.author": map[string]any{
+			"comments": []any{map[string]any{"author": "ann"}},
+		},
+	}
+
+	for path, want := range tests {
+		var got any
+
+		if getJSON(t, server.URL+path, &got); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+
+	// Projections never touch the stored data
+	var book map[string]any
+
+	if getJSON(t, server.URL+"/books/1", &book); book["internal"] != "x" || len(book["author"].(map[string]any)) != 2 {
+		t.Fatalf("projection changed the stored book: %v", book)
+	}
+}
@@ -1,142 +1,320 @@
 package router
 
 import (
-	"fmt"
+	"cmp"
+	"hson-server/internal/datatree"
 	"hson-server/internal/logger"
 	"net/url"
-	"sort"
-	"strconv"
+	"slices"
+	"strings"
 	"time"
 )
 
 type QueryOptions struct {
-	Filters map[string]string
-	SortKey string
-	Desc    bool
-	Offset  int
-	Limit   int
+	Search     string
+	Filters    map[string]string
+	Sort       []SortKey
+	NullsFirst bool
+	Numeric    bool
+	Offset     int
+	Limit      int
+	Page       int
+
+	// Paginated is set when any of page, limit, offset or cursor was requested
+	Paginated bool
+
+	// Cursor pagination (?cursor= or ?after=) resumes after the item the cursor was taken from
+	CursorMode bool
+	Cursor     string
+	KeyFields  []string
+
+	// Aggregate replaces the matching items by summary values e.g: ?_count&_sum=price
+	Aggregate Aggregation
+}
+
+// PageInfo describes the part of a collection returned by a query
+type PageInfo struct {
+	Total     int
+	Offset    int
+	Limit     int
+	Paginated bool
+
+	// NextCursor resumes cursor pagination after the last returned item, empty on the last page
+	CursorMode bool
+	NextCursor string
+}
+
+// Page returns the 1-indexed page the result starts on
+func (info PageInfo) Page() int {
+	if info.Limit <= 0 {
+		return 1
+	}
+	return info.Offset/info.Limit + 1
+}
+
+// SortKey is one field of a multi-key sort e.g: ?sort=author,-year => [{author}, {year desc}]
+type SortKey struct {
+	Field string
+	Desc  bool
 }
 
-func applyQuery(rawData any, qs url.Values) any {
+// applyQuery filters, sorts and paginates the array data at urlPath, joining relations from root.
+// The page info is nil for non-array data.
+func applyQuery(rawData any, root any, urlPath string, qs url.Values) (any, *PageInfo, error) {
+	// Get fields=/exclude= projection, which also applies to single resources
+	projection := parseProjection(qs)
+
+	// Get _embed=/_expand= relations, which also apply to single resources
+	relations, err := parseRelations(qs)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Attempt to parse raw data to an array since query params only supported on arrays
 	arr, ok := rawData.([]any)
 
-	// If data isn't an array or empty array, return raw data
-	if !ok || len(qs) == 0 {
-		return rawData
+	// If data isn't an array, return raw data
+	if !ok {
+		return projection.apply(relations.apply(root, urlPath, rawData)), nil, nil
+	}
+
+	// Without query params, the whole array is a single page
+	if len(qs) == 0 {
+		return rawData, &PageInfo{Total: len(arr)}, nil
 	}
 
 	// Get all necessary filter options from url values
 	filterOptions := parseQuery(qs)
 
+	// Cursors break sort ties by the collection's primary key
+	filterOptions.KeyFields = datatree.KeyFields(datatree.SplitPath(urlPath))
+
 	start := time.Now()
 
+	// Aggregations summarize every matching item, so they skip sorting and pagination
+	if filterOptions.Aggregate.active() {
+		result := aggregate(selectItems(arr, filterOptions), filterOptions.Aggregate, filterOptions.Numeric)
+
+		logger.Debug("Applied query aggregation", "filters", qs, "aggregate_duration", time.Since(start))
+
+		return result, nil, nil
+	}
+
 	// Return a new data slice with filters applied
-	data := pipeline(arr, filterOptions)
+	data, total, nextCursor, err := pipeline(arr, filterOptions)
+
+	if err != nil {
+		return nil, nil, err
+	}
 
 	logger.Debug("Applied query filters",
 		"filters", qs,
 		"items_count", countItems(data),
+		"total_count", total,
 		"filter_duration", time.Since(start),
 	)
 
-	// Return new data with filters applied
-	return data
+	// Join related items into the page, then project the fields the client asked for
+	joined := relations.apply(root, urlPath, data)
+
+	// Return new data with filters and projection applied
+	return projection.apply(joined), &PageInfo{
+		Total:     total,
+		Offset:    filterOptions.Offset,
+		Limit:     filterOptions.Limit,
+		Paginated: filterOptions.Paginated,
+
+		CursorMode: filterOptions.CursorMode,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// pipeline applies search → filter → sort → paginate in order.
+// It also returns the number of matching items before pagination, and the next cursor in cursor mode.
+func pipeline(arr []any, opts QueryOptions) ([]any, int, string, error) {
+	arr = selectItems(arr, opts)
+	// Sorting happens in place, so never sort the snapshot's own slice
+	if len(opts.Sort) > 0 || opts.CursorMode {
+		arr = slices.Clone(arr)
+	}
+	if opts.CursorMode {
+		page, next, err := paginateCursor(arr, opts)
+		return page, len(arr), next, err
+	}
+	if len(opts.Sort) > 0 {
+		sortArray(arr, opts)
+	}
+	return paginateArray(arr, opts.Offset, opts.Limit), len(arr), "", nil
 }
 
-// pipeline applies filter → sort → paginate in order.
-func pipeline(arr []any, opts QueryOptions) []any {
+// selectItems applies the search and filters of a query.
+func selectItems(arr []any, opts QueryOptions) []any {
+	if opts.Search != "" {
+		arr = searchArray(arr, opts.Search)
+	}
 	if len(opts.Filters) > 0 {
 		arr = filterArray(arr, opts.Filters)
 	}
-	if opts.SortKey != "" {
-		sortArray(arr, opts.SortKey, opts.Desc)
-	}
-	return paginateArray(arr, opts.Offset, opts.Limit)
+	return arr
 }
 
-// filterArray retains only items matching all filter key-values.
+// filterArray retains only items matching all filters, including operator suffixes like _gte or _like.
 func filterArray(arr []any, filters map[string]string) []any {
+	parsed := datatree.ParseFilters(filters)
 	out := make([]any, 0, len(arr))
 	for _, item := range arr {
-		if obj, ok := item.(map[string]any); ok {
-			match := true
-			for k, want := range filters {
-				val, exists := obj[k]
-
-				if !exists {
-					match = false
-					break
-				}
-
-				switch v := val.(type) {
-				case float64:
-					w, err := strconv.ParseFloat(want, 64)
-					if err != nil || v != w {
-						match = false
-					}
-				default:
-					if fmt.Sprint(v) != want {
-						match = false
-					}
-				}
-
-				if !match {
-					break
-				}
-			}
-			if match {
-				out = append(out, item)
-			}
-		} else if want, ok := filters["value"]; ok {
-			if fmt.Sprint(item) == want {
-				out = append(out, item)
-			}
+		if datatree.MatchesAll(item, parsed) {
+			out = append(out, item)
 		}
 	}
 	return out
 }
 
-// sortArray orders the slice by key, ascending or descending.
-func sortArray(arr []any, key string, desc bool) {
-	sort.SliceStable(arr, func(i, j int) bool {
-		ai, aok := arr[i].(map[string]any)
-		bi, bok := arr[j].(map[string]any)
-		if !aok || !bok {
-			return false
+// searchArray retains only items containing every term of the query in some string field.
+func searchArray(arr []any, query string) []any {
+	tokens := datatree.SearchTokens(query)
+	out := make([]any, 0, len(arr))
+	for _, item := range arr {
+		if datatree.MatchesText(item, tokens) {
+			out = append(out, item)
 		}
+	}
+	return out
+}
 
-		aVal, aok := ai[key]
-		bVal, bok := bi[key]
-		if !aok || !bok {
-			return false
-		}
+// sortArray orders the slice by each sort key in turn, later keys breaking ties of earlier ones.
+// Missing and null values are placed first or last regardless of the sort direction.
+func sortArray(arr []any, opts QueryOptions) {
+	slices.SortStableFunc(arr, func(a, b any) int {
+		return compareItems(a, b, opts.Sort, opts)
+	})
+}
 
-		switch av := aVal.(type) {
-		case float64:
-			bv, ok := bVal.(float64)
-			if !ok {
-				return !desc
+// compareItems orders two items by the given sort keys
+func compareItems(a, b any, keys []SortKey, opts QueryOptions) int {
+	for _, key := range keys {
+		aVal, aok := datatree.FieldValue(a, key.Field)
+		bVal, bok := datatree.FieldValue(b, key.Field)
+
+		aNull, bNull := !aok || aVal == nil, !bok || bVal == nil
+
+		if aNull || bNull {
+			if aNull == bNull {
+				continue
 			}
-			if desc {
-				return bv < av
+			if aNull == opts.NullsFirst {
+				return -1
 			}
-			return av < bv
+			return 1
+		}
+
+		order := compareValues(aVal, bVal, opts.Numeric)
+		if order == 0 {
+			continue
+		}
+		if key.Desc {
+			return -order
+		}
+		return order
+	}
+	return 0
+}
 
-		case string:
-			bv, ok := bVal.(string)
-			if !ok {
-				return desc
+// compareValues orders two non-null values. Values of different types are ranked
+// numbers < strings < booleans < objects/arrays so mixed columns still sort deterministically.
+func compareValues(a, b any, numeric bool) int {
+	if rank := cmp.Compare(typeRank(a), typeRank(b)); rank != 0 {
+		return rank
+	}
+
+	switch av := a.(type) {
+	case float64:
+		return cmp.Compare(av, b.(float64))
+
+	case string:
+		bv := b.(string)
+
+		// ISO timestamps sort chronologically, whatever their precision or zone
+		if at, ok := datatree.ParseDate(av); ok {
+			if bt, ok := datatree.ParseDate(bv); ok {
+				return at.Compare(bt)
 			}
-			if desc {
-				return bv < av
+		}
+
+		if numeric {
+			return naturalCompare(av, bv)
+		}
+		return strings.Compare(av, bv)
+
+	case bool:
+		if av == b.(bool) {
+			return 0
+		}
+		if av {
+			return 1
+		}
+		return -1
+
+	default:
+		return 0
+	}
+}
+
+func typeRank(v any) int {
+	switch v.(type) {
+	case float64:
+		return 0
+	case string:
+		return 1
+	case bool:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// naturalCompare compares strings with runs of digits ordered by their numeric value,
+// e.g: "item2" < "item10"
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		aDigits, bDigits := isDigit(a[0]), isDigit(b[0])
+
+		if !aDigits || !bDigits {
+			if a[0] != b[0] {
+				return cmp.Compare(a[0], b[0])
 			}
-			return av < bv
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// Compare the numbers without leading zeros by length first, then digit by digit
+		aRun, bRun := digitRun(a), digitRun(b)
+		aNum, bNum := strings.TrimLeft(a[:aRun], "0"), strings.TrimLeft(b[:bRun], "0")
 
-		default:
-			return false
+		if order := cmp.Compare(len(aNum), len(bNum)); order != 0 {
+			return order
 		}
-	})
+		if order := strings.Compare(aNum, bNum); order != 0 {
+			return order
+		}
+
+		a, b = a[aRun:], b[bRun:]
+	}
+
+	return cmp.Compare(len(a), len(b))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
 }
 
 // paginateArray slices the array according to offset and limit.
@@ -0,0 +1,153 @@
+package router
+
+import (
+	"slices"
+	"testing"
+)
+
+const seedRatings = `{
+  books: [
+    {id: 1, title: "The Hobbit", stats: {rating: 4.2}, author: {name: "Tolkien"}}
+    {id: 2, title: "Dune", stats: {rating: 4.5}, author: {name: "Herbert"}}
+    {id: 3, title: "Untitled"}
+    {id: 4, title: "Emma", stats: {rating: 3.9}, author: {name: "Austen"}}
+  ]
+}
+`
+
+// ids returns the ids of the books a query returns, in order
+func ids(t *testing.T, url string) []float64 {
+	t.Helper()
+
+	var books []map[string]any
+	getJSON(t, url, &books)
+
+	ids := make([]float64, len(books))
+
+	for i, book := range books {
+		ids[i], _ = book["id"].(float64)
+	}
+
+	return ids
+}
+
+func TestNestedFieldQueries(t *testing.T) {
+	tests := map[string][]float64{
+		// Items missing the sort key come last in both directions
+		"/books?sort=stats.rating":      {4, 1, 2, 3},
+		"/books?sort=-stats.rating":     {2, 1, 4, 3},
+		"/books?author.name=Tolkien":    {1},
+		"/books?stats.rating_gte=4":     {1, 2},
+		"/books?author.name_ne=Herbert": {1, 3, 4},
+	}
+
+	for path, want := range tests {
+		server := newTestServer(t, seedRatings)
+
+		if got := ids(t, server.URL+path); !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	server := newTestServer(t, seedRatings)
+
+	if got := ids(t, server.URL+"/books?q=TOLKIEN%20hobbit"); !slices.Equal(got, []float64{1}) {
+		t.Errorf("got %v, want [1]", got)
+	}
+
+	var hits []map[string]any
+	getJSON(t, server.URL+"/__search?q=dune", &hits)
+
+	if len(hits) != 1 || hits[0]["path"] != "/books/2" {
+		t.Errorf("got %v, want a hit at /books/2", hits)
+	}
+}
+
+func TestMultiKeySort(t *testing.T) {
+	const seed = `{
+  books: [
+    {id: 1, author: "Le Guin", year: 1969, code: "item10", published: "1969-03-01T10:00:00Z"}
+    {id: 2, author: "Herbert", year: 1965, code: "item2", published: "1965-08-01"}
+    {id: 3, author: "Le Guin", year: 1974, code: "item1"}
+    {id: 4, author: null, year: 1990, code: "item20", published: "1969-03-01T09:00:00+01:00"}
+  ]
+}
+`
+
+	tests := map[string][]float64{
+		"/books?sort=author,-year":             {2, 3, 1, 4},
+		"/books?sort=author,-year&nulls=first": {4, 2, 3, 1},
+		"/books?sort=code":                     {3, 1, 2, 4},
+		"/books?sort=code&collation=numeric":   {3, 2, 1, 4},
+		"/books?sort=-code&collation=numeric":  {4, 1, 2, 3},
+		"/books?sort=published":                {2, 4, 1, 3},
+		"/books?sort=-published&nulls=first":   {3, 1, 4, 2},
+	}
+
+	for path, want := range tests {
+		server := newTestServer(t, seed)
+
+		if got := ids(t, server.URL+path); !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPaginationHeaders(t *testing.T) {
+	server := newTestServer(t, `{books: [{id: 1}, {id: 2}, {id: 3}, {id: 4}, {id: 5}]}`)
+
+	var page []map[string]any
+	response := getJSON(t, server.URL+"/books?id_gt=0&limit=2&page=2", &page)
+
+	if total := response.Header.Get("X-Total-Count"); total != "5" || len(page) != 2 {
+		t.Fatalf("got %d items of %s, want 2 of 5", len(page), total)
+	}
+
+	want := `</books?id_gt=0&limit=2&page=1>; rel="first", </books?id_gt=0&limit=2&page=1>; rel="prev", ` +
+		`</books?id_gt=0&limit=2&page=3>; rel="next", </books?id_gt=0&limit=2&page=3>; rel="last"`
+
+	if link := response.Header.Get("Link"); link != want {
+		t.Fatalf("got Link %s\nwant %s", link, want)
+	}
+
+	// Offset style requests get offset links
+	response = getJSON(t, server.URL+"/books?offset=4&limit=2", &page)
+
+	want = `</books?limit=2&offset=0>; rel="first", </books?limit=2&offset=2>; rel="prev", </books?limit=2&offset=4>; rel="last"`
+
+	if link := response.Header.Get("Link"); link != want {
+		t.Fatalf("got Link %s\nwant %s", link, want)
+	}
+
+	// Unpaginated requests have no pagination headers
+	if response := getJSON(t, server.URL+"/books", &page); response.Header.Get("X-Total-Count") != "" {
+		t.Fatal("unpaginated response carries X-Total-Count")
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	server := newTestServer(t, `{books: [{id: 1}, {id: 2}, {id: 3}]}`)
+
+	var envelope struct {
+		Data               []map[string]any
+		Total, Page, Limit int
+	}
+
+	getJSON(t, server.URL+"/books?_envelope=true&limit=2&page=2", &envelope)
+
+	if len(envelope.Data) != 1 || envelope.Total != 3 || envelope.Page != 2 || envelope.Limit != 2 {
+		t.Fatalf("got envelope %+v", envelope)
+	}
+
+	defer func() { Envelope = false }()
+	Envelope = true
+
+	var books []map[string]any
+	getJSON(t, server.URL+"/books?_envelope=false", &books)
+
+	if len(books) != 3 {
+		t.Fatalf("got %v with the envelope turned off", books)
+	}
+}
@@ -0,0 +1,330 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"hson-server/internal/datatree"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var (
+	// ForeignKeyPattern names the field referencing a parent, {name} being its singular name
+	ForeignKeyPattern = "{name}Id"
+
+	// RelationDepth caps how many relations a dotted _embed / _expand chain may follow
+	RelationDepth = 2
+)
+
+// ErrRelationDepth is returned for _embed / _expand chains longer than RelationDepth
+var ErrRelationDepth = errors.New("relation chain too deep")
+
+// relations are the ?_embed= and ?_expand= chains of a request, e.g: _embed=reviews.comments
+type relations struct {
+	embed  [][]string
+	expand [][]string
+}
+
+func parseRelations(qs url.Values) (relations, error) {
+	var rel relations
+	var err error
+
+	if rel.embed, err = splitRelations(qs["_embed"]); err != nil {
+		return rel, err
+	}
+
+	rel.expand, err = splitRelations(qs["_expand"])
+
+	return rel, err
+}
+
+// splitRelations reads repeated and comma separated relation params into dotted chains
+func splitRelations(params []string) ([][]string, error) {
+	var chains [][]string
+
+	for _, param := range params {
+		for _, chain := range splitFieldPaths(param) {
+			if len(chain) > RelationDepth {
+				return nil, fmt.Errorf("%w: %q follows %d relations, the limit is %d", ErrRelationDepth, strings.Join(chain, "."), len(chain), RelationDepth)
+			}
+
+			chains = append(chains, chain)
+		}
+	}
+
+	return chains, nil
+}
+
+// apply joins related collections into the items of value, the data at urlPath. Collections of
+// a relation are looked up next to the collection the items belong to, e.g: /api/books => /api/reviews
+func (rel relations) apply(root any, urlPath string, value any) any {
+	if len(rel.embed) == 0 && len(rel.expand) == 0 {
+		return value
+	}
+
+	parts := datatree.SplitPath(urlPath)
+
+	switch v := value.(type) {
+	case []any:
+		// Collection route e.g: /books
+		if len(parts) == 0 {
+			return value
+		}
+
+		out := make([]any, len(v))
+
+		for i, item := range v {
+			out[i] = rel.applyItem(root, parts, item)
+		}
+
+		return out
+
+	case map[string]any:
+		// Item route e.g: /books/1, only if the parent really is a collection
+		if len(parts) < 2 {
+			return value
+		}
+
+		parent, err := datatree.Lookup(root, strings.Join(parts[:len(parts)-1], "/"))
+
+		if _, ok := parent.([]any); err != nil || !ok {
+			return value
+		}
+
+		return rel.applyItem(root, parts[:len(parts)-1], v)
+
+	default:
+		return value
+	}
+}
+
+func (rel relations) applyItem(root any, collectionPath []string, item any) any {
+	obj, ok := item.(map[string]any)
+
+	if !ok {
+		return item
+	}
+
+	// Related collections live in the same container as the item's collection
+	containerPath := collectionPath[:len(collectionPath)-1]
+	container, err := datatree.Lookup(root, strings.Join(containerPath, "/"))
+
+	siblings, ok := container.(map[string]any)
+
+	if err != nil || !ok {
+		return item
+	}
+
+	name := collectionPath[len(collectionPath)-1]
+
+	for _, chain := range rel.embed {
+		obj = embed(siblings, containerPath, name, obj, chain)
+	}
+
+	for _, chain := range rel.expand {
+		obj = expand(siblings, containerPath, name, obj, chain)
+	}
+
+	return obj
+}
+
+// embed adds the children referencing item, e.g: book.reviews = reviews where bookId == book.id
+func embed(siblings map[string]any, containerPath []string, collection string, item map[string]any, chain []string) map[string]any {
+	childName := chain[0]
+	children, ok := siblings[childName].([]any)
+
+	if !ok {
+		return item
+	}
+
+	key, ok := datatree.ElementKey(item, append(slices.Clone(containerPath), collection))
+
+	if !ok {
+		return item
+	}
+
+	foreignKey := foreignKeyName(singular(collection))
+	matches := []any{}
+
+	for _, child := range children {
+		childObj, ok := child.(map[string]any)
+
+		if !ok {
+			continue
+		}
+
+		if ref, ok := datatree.KeyString(childObj[foreignKey]); !ok || ref != key {
+			continue
+		}
+
+		// Follow the rest of the chain from the child, e.g: reviews.comments
+		if len(chain) > 1 {
+			childObj = embed(siblings, containerPath, childName, childObj, chain[1:])
+		}
+
+		matches = append(matches, childObj)
+	}
+
+	// Copy the item so the stored data never sees the joined values
+	out := maps.Clone(item)
+	out[childName] = matches
+
+	return out
+}
+
+// expand adds the parent item references, e.g: book.author = the author with id == book.authorId
+func expand(siblings map[string]any, containerPath []string, collection string, item map[string]any, chain []string) map[string]any {
+	name := chain[0]
+
+	ref, ok := datatree.KeyString(item[foreignKeyName(name)])
+
+	if !ok {
+		return item
+	}
+
+	// The parent collection is the plural of the relation name, or the name itself
+	parentCollection := plural(name)
+
+	if _, exists := siblings[parentCollection]; !exists {
+		parentCollection = name
+	}
+
+	parents, ok := siblings[parentCollection].([]any)
+
+	if !ok {
+		return item
+	}
+
+	parent, ok := datatree.FindByPrimaryKey(parents, ref, append(slices.Clone(containerPath), parentCollection))
+
+	if !ok {
+		return item
+	}
+
+	// Follow the rest of the chain from the parent, e.g: author.publisher
+	if len(chain) > 1 {
+		parent = expand(siblings, containerPath, parentCollection, parent, chain[1:])
+	}
+
+	// Copy the item so the stored data never sees the joined values
+	out := maps.Clone(item)
+	out[name] = parent
+
+	return out
+}
+
+func foreignKeyName(name string) string {
+	return strings.ReplaceAll(ForeignKeyPattern, "{name}", name)
+}
+
+// plural is a small English inflection for collection names e.g: author => authors, category => categories
+func plural(name string) string {
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "z"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	default:
+		return name + "s"
+	}
+}
+
+// singular reverses plural e.g: books => book, categories => category
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "zes"),
+		strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return name[:len(name)-1]
+	default:
+		return name
+	}
+}
+
+// nestedRoute is a relational route like /authors/1/books, served from the top-level books
+// collection filtered (or pre-filled, for POST) by the foreign key authorId == 1
+type nestedRoute struct {
+	collection string
+	foreignKey string
+	parentID   any
+}
+
+// resolveNestedRoute recognizes <parents>/<key>/<children> paths where the parent item exists
+// and children is a collection next to parents. Callers only try it for paths missing from the
+// data tree, so physical nested paths always win.
+func resolveNestedRoute(root any, urlPath string) (nestedRoute, bool) {
+	parts := datatree.SplitPath(urlPath)
+
+	if len(parts) < 3 {
+		return nestedRoute{}, false
+	}
+
+	childName := parts[len(parts)-1]
+	parentPath := parts[:len(parts)-2]
+	containerPath := parts[:len(parts)-3]
+
+	// The child collection must be a sibling of the parent collection
+	container, err := datatree.Lookup(root, strings.Join(containerPath, "/"))
+	siblings, ok := container.(map[string]any)
+
+	if err != nil || !ok {
+		return nestedRoute{}, false
+	}
+
+	if _, ok := siblings[childName].([]any); !ok {
+		return nestedRoute{}, false
+	}
+
+	// The parent item must exist in its collection
+	parent, err := datatree.Lookup(root, strings.Join(parts[:len(parts)-1], "/"))
+	parentObj, ok := parent.(map[string]any)
+
+	if err != nil || !ok {
+		return nestedRoute{}, false
+	}
+
+	// Foreign keys reference a single primary key field
+	keyFields := datatree.KeyFields(parentPath)
+
+	if len(keyFields) != 1 {
+		return nestedRoute{}, false
+	}
+
+	parentID, ok := parentObj[keyFields[0]]
+
+	if !ok {
+		return nestedRoute{}, false
+	}
+
+	return nestedRoute{
+		collection: "/" + strings.Join(append(slices.Clone(containerPath), childName), "/"),
+		foreignKey: foreignKeyName(singular(parentPath[len(parentPath)-1])),
+		parentID:   parentID,
+	}, true
+}
+
+// filter returns the children referencing the route's parent
+func (route nestedRoute) filter(children []any) []any {
+	want, _ := datatree.KeyString(route.parentID)
+	out := []any{}
+
+	for _, child := range children {
+		obj, ok := child.(map[string]any)
+
+		if !ok {
+			continue
+		}
+
+		if ref, ok := datatree.KeyString(obj[route.foreignKey]); ok && ref == want {
+			out = append(out, child)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+)
+
+const seedRelations = `{
+  publishers: [{id: 1, name: "Chilton"}]
+  authors: [{id: 1, name: "Herbert", publisherId: 1}]
+  books: [{id: 1, title: "Dune", authorId: 1}, {id: 2, title: "Lost", authorId: 9}]
+  reviews: [{id: 1, bookId: 1, stars: 5}, {id: 2, bookId: 1, stars: 4}]
+}
+`
+
+func TestEmbedAndExpand(t *testing.T) {
+	server := newTestServer(t, seedRelations)
+
+	var books []map[string]any
+	getJSON(t, server.URL+"/books?_embed=reviews&_expand=author", &books)
+
+	if reviews := books[0]["reviews"].([]any); len(reviews) != 2 {
+		t.Errorf("embedded %v, want both reviews of book 1", reviews)
+	}
+
+	if author := books[0]["author"].(map[string]any); author["name"] != "Herbert" {
+		t.Errorf("expanded %v, want Herbert", author)
+	}
+
+	if reviews := books[1]["reviews"].([]any); len(reviews) != 0 {
+		t.Errorf("embedded %v into a book without reviews", reviews)
+	}
+
+	// Dotted chains follow relations further
+	var book map[string]any
+	getJSON(t, server.URL+"/books/1?_expand=author.publisher&fields=title,author.publisher.name", &book)
+
+	if publisher := book["author"].(map[string]any)["publisher"].(map[string]any); publisher["name"] != "Chilton" || book["title"] != "Dune" {
+		t.Errorf("got %v, want the publisher of the author of Dune", book)
+	}
+
+	if response, _ := send(t, http.MethodGet, server.URL+"/books?_embed=reviews.comments.likes", nil, ""); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %d for a chain deeper than --relation-depth, want 400", response.StatusCode)
+	}
+}
+
+func TestForeignKeyPattern(t *testing.T) {
+	defer func(pattern string) { ForeignKeyPattern = pattern }(ForeignKeyPattern)
+	ForeignKeyPattern = "{name}_id"
+
+	server := newTestServer(t, `{authors: [{id: 1, name: "Herbert"}], books: [{id: 1, author_id: 1}]}`)
+
+	var author map[string]any
+	getJSON(t, server.URL+"/authors/1?_embed=books", &author)
+
+	if books := author["books"].([]any); len(books) != 1 {
+		t.Fatalf("embedded %v, want the book by author_id", books)
+	}
+}
+
+func TestRelationalRoutes(t *testing.T) {
+	server := newTestServer(t, `{
+  authors: [{id: 1, name: "Herbert"}, {id: 2, name: "Austen", books: [{id: 7, title: "Emma"}]}]
+  books: [{id: 1, title: "Dune", authorId: 1}, {id: 2, title: "Emma", authorId: 2}]
+}
+`)
+
+	var books []map[string]any
+	getJSON(t, server.URL+"/authors/1/books?fields=title", &books)
+
+	if len(books) != 1 || books[0]["title"] != "Dune" {
+		t.Fatalf("got %v, want the books of author 1", books)
+	}
+
+	// Posting through the parent fills in the foreign key
+	response, body := send(t, http.MethodPost, server.URL+"/authors/1/books", nil, `{"title": "Dune Messiah"}`)
+
+	if response.StatusCode != http.StatusCreated || response.Header.Get("Location") != "/books/3" {
+		t.Fatalf("got %d %s at %q, want 201 at /books/3", response.StatusCode, body, response.Header.Get("Location"))
+	}
+
+	var book map[string]any
+
+	if getJSON(t, server.URL+"/books/3", &book); book["authorId"] != float64(1) {
+		t.Fatalf("got %v, want authorId 1", book)
+	}
+
+	// Nested data wins over the relation
+	if getJSON(t, server.URL+"/authors/2/books", &books); len(books) != 1 || books[0]["id"] != float64(7) {
+		t.Fatalf("got %v, want the nested books of author 2", books)
+	}
+
+	if response, _ := send(t, http.MethodGet, server.URL+"/authors/9/books", nil, ""); response.StatusCode != http.StatusNotFound {
+		t.Fatalf("got %d for a missing parent, want 404", response.StatusCode)
+	}
+}
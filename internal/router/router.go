@@ -1,6 +1,8 @@
 package router
 
 import (
+	"flag"
+	"hson-server/internal/datatree"
 	"hson-server/internal/logger"
 	"net/http"
 	"net/url"
@@ -8,13 +10,37 @@ import (
 	"time"
 )
 
+// Envelope wraps every array response as {data, total, page, limit} unless ?_envelope=false
+var Envelope bool
+
+func RegisterFlags() {
+	flag.BoolVar(&Envelope, "envelope", false, "wrap array responses as {data, total, page, limit} (override per request with ?_envelope=)")
+	flag.StringVar(&ForeignKeyPattern, "fk-pattern", "{name}Id", "foreign key naming used by _embed and _expand, {name} is the singular parent name e.g: {name}_id")
+	flag.IntVar(&RelationDepth, "relation-depth", 2, "maximum number of relations a dotted _embed / _expand chain may follow")
+}
+
 // HSONStore defines operations for reading/writing HSON data
 // Inferface is implemented in app package
 type HSONStore interface {
 	Read(path string) (any, error)
-	Write(path string, newVal any) error
-	Delete(path string, values url.Values) error
-	Patch(path string, patchData map[string]any) error
+	Write(path string, newVal any, ifMatch string) error
+	Append(path string, item any) (string, error)
+	Delete(path string, values url.Values, ifMatch string) error
+	Patch(path string, patchData map[string]any, ifMatch string) error
+	JSONPatch(path string, ops []any, ifMatch string) error
+	MergePatch(path string, patch any, ifMatch string) error
+
+	// History lists the undoable and redoable changes, newest first
+	History() (undo, redo []datatree.Operation)
+	Undo() (datatree.Operation, error)
+	Redo() (datatree.Operation, error)
+
+	// Named snapshots and resets restore the value at a path ("/" for everything)
+	SaveSnapshot(name string) error
+	NamedSnapshots() map[string]time.Time
+	DeleteSnapshot(name string) error
+	RestoreSnapshot(name, path string) error
+	Reset(path string) error
 }
 
 func NewHTTPHandler(store HSONStore) http.Handler {
@@ -24,6 +50,22 @@ func NewHTTPHandler(store HSONStore) http.Handler {
 	// Register a dispatcher function at the root path
 	handler.HandleFunc("/", handlerDispatcher(store))
 
+	// Register full-text search across all collections
+	handler.HandleFunc("/__search", handleSearchRequest(store))
+
+	// Register the OpenAPI document inferred from the current data
+	handler.HandleFunc("/__openapi.json", handleOpenAPIRequest(store))
+
+	// Register the admin endpoints to inspect and revert changes
+	handler.HandleFunc("/__admin/history", handleHistoryRequest(store))
+	handler.HandleFunc("/__admin/undo", handleUndoRequest(store))
+	handler.HandleFunc("/__admin/redo", handleRedoRequest(store))
+
+	// Register the admin endpoints to save and restore data for test isolation
+	handler.HandleFunc("/__admin/snapshots", handleSnapshotListRequest(store))
+	handler.HandleFunc("/__admin/snapshots/", handleSnapshotRequest(store))
+	handler.HandleFunc("/__admin/reset", handleResetRequest(store))
+
 	// Return the configured router
 	return addCORSAndNormalizeURL(addDelay(handler))
 }
@@ -58,7 +100,8 @@ func addCORSAndNormalizeURL(next http.Handler) http.Handler {
 		// Set necessary CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,If-Match,If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag,Location,Link,X-Total-Count,X-Next-Cursor")
 
 		// Handle potential OPTIONS requests from browsers
 		if r.Method == http.MethodOptions {
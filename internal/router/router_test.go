@@ -0,0 +1,101 @@
+package router
+
+import (
+	"encoding/json"
+	"hson-server/internal/app"
+	"hson-server/internal/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const seedLibrary = `{
+  authors: [
+    {id: 1, name: "Le Guin"}
+    {id: 2, name: "Herbert"}
+  ]
+  books: [
+    {id: 1, authorId: 1, title: "The Dispossessed"}
+    {id: 2, authorId: 2, title: "Dune"}
+  ]
+}
+`
+
+// newTestServer serves the seed data from memory, as --store=memory does
+func newTestServer(t *testing.T, seed string) *httptest.Server {
+	t.Helper()
+
+	seedPath := filepath.Join(t.TempDir(), "data.hson")
+
+	if err := os.WriteFile(seedPath, []byte(seed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &app.App{Backend: storage.NewMemory(seedPath)}
+
+	if err := store.LoadDataFromFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(NewHTTPHandler(store))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// send makes a request and returns the response with its body read, bodies are sent as JSON unless
+// the header says otherwise. It only reports errors with t.Error so it can be called from other goroutines
+func send(t *testing.T, method, url string, header http.Header, body string) (*http.Response, string) {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+
+	if err != nil {
+		t.Error(err)
+		return &http.Response{}, ""
+	}
+
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Error(err)
+		return &http.Response{}, ""
+	}
+
+	defer response.Body.Close()
+
+	raw, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	return response, string(raw)
+}
+
+// getJSON makes a GET request and decodes the JSON response into v
+func getJSON(t *testing.T, url string, v any) *http.Response {
+	t.Helper()
+
+	response, body := send(t, http.MethodGet, url, nil, "")
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", url, response.StatusCode, body)
+	}
+
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+
+	return response
+}
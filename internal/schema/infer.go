@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"maps"
+	"math"
+	"slices"
+)
+
+// shape accumulates what is known about every sample value seen at one place of the data tree
+type shape struct {
+	types map[string]bool
+
+	// Objects: how many samples were objects, and how many of them had each property
+	objects    int
+	properties map[string]*shape
+	seen       map[string]int
+
+	// Arrays: the merged shape of every element
+	items *shape
+}
+
+// Infer derives a JSON Schema describing value, e.g: [{id: 1, tags: ["a"]}] =>
+// {type: "array", items: {type: "object", properties: {...}, required: ["id", "tags"]}}.
+// Array elements are merged, so a property is only required if every element has it.
+func Infer(value any) map[string]any {
+	return sample(&shape{}, value).schema()
+}
+
+// sample merges one more value into the shape
+func sample(s *shape, value any) *shape {
+	if s.types == nil {
+		s.types = map[string]bool{}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		s.types["null"] = true
+
+	case bool:
+		s.types["boolean"] = true
+
+	case float64:
+		if v == math.Trunc(v) {
+			s.types["integer"] = true
+		} else {
+			s.types["number"] = true
+		}
+
+	case string:
+		s.types["string"] = true
+
+	case map[string]any:
+		s.types["object"] = true
+		s.objects++
+
+		if s.properties == nil {
+			s.properties, s.seen = map[string]*shape{}, map[string]int{}
+		}
+
+		for key, field := range v {
+			if s.properties[key] == nil {
+				s.properties[key] = &shape{}
+			}
+
+			sample(s.properties[key], field)
+			s.seen[key]++
+		}
+
+	case []any:
+		s.types["array"] = true
+
+		if s.items == nil {
+			s.items = &shape{}
+		}
+
+		for _, elem := range v {
+			sample(s.items, elem)
+		}
+	}
+
+	return s
+}
+
+// schema renders the accumulated shape as a JSON Schema
+func (s *shape) schema() map[string]any {
+	out := map[string]any{}
+
+	// Integers are numbers too, so a field mixing both is simply a number
+	if s.types["number"] {
+		delete(s.types, "integer")
+	}
+
+	types := slices.Sorted(maps.Keys(s.types))
+
+	switch len(types) {
+	case 0:
+		// Nothing was sampled e.g: the items of an empty array, so anything goes
+		return out
+	case 1:
+		out["type"] = types[0]
+	default:
+		out["type"] = types
+	}
+
+	if s.types["object"] {
+		properties := map[string]any{}
+		required := []string{}
+
+		for _, key := range slices.Sorted(maps.Keys(s.properties)) {
+			properties[key] = s.properties[key].schema()
+
+			if s.seen[key] == s.objects {
+				required = append(required, key)
+			}
+		}
+
+		out["properties"] = properties
+
+		if len(required) > 0 {
+			out["required"] = required
+		}
+	}
+
+	if s.types["array"] {
+		out["items"] = s.items.schema()
+	}
+
+	return out
+}
@@ -0,0 +1,32 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInfer(t *testing.T) {
+	books := []any{
+		map[string]any{"id": float64(1), "title": "Dune", "tags": []any{"sf"}, "rating": 4.5},
+		map[string]any{"id": float64(2), "title": "Emma", "rating": float64(4)},
+	}
+
+	want := map[string]any{
+		"type": "array",
+		"items": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"id":     map[string]any{"type": "integer"},
+				"title":  map[string]any{"type": "string"},
+				"tags":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				"rating": map[string]any{"type": "number"},
+			},
+			// Only fields every item has are required
+			"required": []string{"id", "rating", "title"},
+		},
+	}
+
+	if got := Infer(books); !reflect.DeepEqual(got, want) {
+		t.Fatalf("inferred %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"hson-server/internal/datatree"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hjson/hjson-go"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// SectionKey is the top-level key of a data file holding its own schema definitions
+const SectionKey = "$schema"
+
+var (
+	// ErrInvalid is wrapped by every ValidationError
+	ErrInvalid = errors.New("data does not match its schema")
+
+	// ErrInvalidSchema is returned when a schema definition itself can't be compiled
+	ErrInvalidSchema = errors.New("invalid schema definition")
+)
+
+// Violation is a single schema failure, machine-readable for API clients
+type Violation struct {
+	Path    string `json:"path"`
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every violation found in a data tree
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	first := e.Violations[0]
+
+	return fmt.Sprintf("%v: %d violation(s), first at %s: %s", ErrInvalid, len(e.Violations), first.Path, first.Message)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+// Validator checks collections of the data tree against the JSON Schema configured for their path.
+// A nil Validator accepts everything.
+type Validator struct {
+	schemas map[string]*jsonschema.Schema
+}
+
+// LoadFile reads schema definitions from a HJSON / JSON file mapping collection paths to schemas
+func LoadFile(path string) (map[string]any, error) {
+	raw, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions map[string]any
+
+	if err := hjson.Unmarshal(raw, &definitions); err != nil {
+		return nil, fmt.Errorf("invalid schema file %q: %w", path, err)
+	}
+
+	return definitions, nil
+}
+
+// New compiles schema definitions, e.g: {books: {type: "object", required: ["title"]}}.
+// Definitions passed later override earlier ones for the same path.
+func New(definitions ...map[string]any) (*Validator, error) {
+	merged := map[string]any{}
+
+	for _, defs := range definitions {
+		for collection, definition := range defs {
+			merged[strings.Trim(collection, "/")] = definition
+		}
+	}
+
+	if len(merged) == 0 {
+		return nil, nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	validator := &Validator{schemas: make(map[string]*jsonschema.Schema, len(merged))}
+
+	for collection, definition := range merged {
+		url := "mem:///" + collection + ".json"
+
+		if err := compiler.AddResource(url, definition); err != nil {
+			return nil, fmt.Errorf("%w for %q: %w", ErrInvalidSchema, collection, err)
+		}
+
+		compiled, err := compiler.Compile(url)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w for %q: %w", ErrInvalidSchema, collection, err)
+		}
+
+		validator.schemas[collection] = compiled
+	}
+
+	return validator, nil
+}
+
+// FromData compiles the schema definitions of a data tree's $schema section on top of base
+func FromData(data map[string]any, base map[string]any) (*Validator, error) {
+	section, _ := data[SectionKey].(map[string]any)
+
+	return New(base, section)
+}
+
+// Validate checks every configured collection affected by a change at changedPath ("/" for all).
+// Array collections have each element validated, anything else is validated as a whole.
+func (v *Validator) Validate(root map[string]any, changedPath string) error {
+	if v == nil {
+		return nil
+	}
+
+	changed := datatree.SplitPath(changedPath)
+	violations := []Violation{}
+
+	// Walk collections in a stable order so violations are reported consistently
+	collections := make([]string, 0, len(v.schemas))
+
+	for collection := range v.schemas {
+		collections = append(collections, collection)
+	}
+
+	slices.Sort(collections)
+
+	for _, collection := range collections {
+		parts := datatree.SplitPath(collection)
+
+		if !overlaps(parts, changed) {
+			continue
+		}
+
+		value, err := datatree.Lookup(root, collection)
+
+		// Collections that don't exist yet have nothing to validate
+		if err != nil {
+			continue
+		}
+
+		compiled := v.schemas[collection]
+
+		if items, ok := value.([]any); ok {
+			for i, item := range items {
+				// Report elements by primary key when they have one, like their URL
+				key, ok := datatree.ElementKey(item, parts)
+
+				if !ok {
+					key = strconv.Itoa(i)
+				}
+
+				violations = append(violations, check(compiled, item, "/"+collection+"/"+key)...)
+			}
+
+			continue
+		}
+
+		violations = append(violations, check(compiled, value, "/"+collection)...)
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+
+	return nil
+}
+
+// check validates value and turns failures into violations rooted at path
+func check(compiled *jsonschema.Schema, value any, path string) []Violation {
+	err := compiled.Validate(value)
+
+	var validationErr *jsonschema.ValidationError
+
+	if !errors.As(err, &validationErr) {
+		if err != nil {
+			return []Violation{{Path: path, Message: err.Error()}}
+		}
+
+		return nil
+	}
+
+	var violations []Violation
+
+	for _, unit := range validationErr.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+
+		violations = append(violations, Violation{
+			Path:    path + unit.InstanceLocation,
+			Keyword: unit.KeywordLocation,
+			Message: unit.Error.String(),
+		})
+	}
+
+	return violations
+}
+
+// overlaps reports whether one path is a prefix of the other, i.e. a change at one can affect the other
+func overlaps(a, b []string) bool {
+	n := min(len(a), len(b))
+
+	return slices.Equal(a[:n], b[:n])
+}
@@ -0,0 +1,78 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+var userSchema = map[string]any{
+	"users": map[string]any{
+		"type":     "object",
+		"required": []any{"name"},
+		"properties": map[string]any{
+			"age": map[string]any{"type": "integer", "minimum": float64(0)},
+		},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	validator, err := New(userSchema)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := map[string]any{
+		"users": []any{
+			map[string]any{"id": float64(1), "name": "Ann", "age": float64(30)},
+			map[string]any{"id": float64(2), "age": float64(-1)},
+		},
+		"tags": []any{"x"},
+	}
+
+	// Elements are validated one by one and reported by their URL
+	var validationErr *ValidationError
+
+	if err := validator.Validate(root, "/users/2"); !errors.As(err, &validationErr) || !errors.Is(err, ErrInvalid) {
+		t.Fatalf("got %v, want a %v", err, ErrInvalid)
+	}
+
+	if len(validationErr.Violations) != 2 || validationErr.Violations[0].Path != "/users/2" {
+		t.Fatalf("got violations %+v, want two at /users/2", validationErr.Violations)
+	}
+
+	// Changes elsewhere don't revalidate the collection
+	if err := validator.Validate(root, "/tags"); err != nil {
+		t.Fatalf("got %v for a change outside /users", err)
+	}
+
+	root["users"] = []any{map[string]any{"name": "Ann"}}
+
+	if err := validator.Validate(root, "/"); err != nil {
+		t.Fatalf("got %v for valid users", err)
+	}
+}
+
+func TestFromData(t *testing.T) {
+	// The $schema section wins over the base schemas
+	data := map[string]any{
+		"users":    []any{map[string]any{"id": "x"}},
+		SectionKey: map[string]any{"users": map[string]any{"type": "object"}},
+	}
+
+	validator, err := FromData(data, userSchema)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validator.Validate(data, "/"); err != nil {
+		t.Fatalf("got %v, want the $schema section to replace the base schema", err)
+	}
+
+	data[SectionKey] = map[string]any{"users": map[string]any{"type": 5}}
+
+	if _, err := FromData(data, nil); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidSchema)
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// writeFileAtomic writes data to a temp file next to path, fsyncs it and renames it over path.
+// A crash or full disk mid-write leaves the original file untouched.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath, err := stageFile(path, data)
+
+	if err != nil {
+		return err
+	}
+
+	// Atomically swap the new file into place
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Fsync the directory so the rename itself survives a crash
+	return syncDir(filepath.Dir(path))
+}
+
+// stageFile writes data to a fsynced temp file next to path, ready to be renamed over it.
+// The temp file is removed on failure.
+func stageFile(path string, data []byte) (string, error) {
+	dir := filepath.Dir(path)
+
+	// Keep the permissions of the existing file, default to 0644 for new files
+	perm := os.FileMode(0o644)
+
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	// Create the temp file in the same directory so the rename stays on one filesystem
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	tmpPath := tmp.Name()
+
+	// Remove the temp file on any failure before it is handed over
+	staged := false
+
+	defer func() {
+		if !staged {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return "", err
+	}
+
+	// Flush file contents to stable storage before it becomes visible under the real name
+	if err := tmp.Sync(); err != nil {
+		return "", err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return "", err
+	}
+
+	staged = true
+
+	return tmpPath, nil
+}
+
+func syncDir(dir string) error {
+	// Directories cannot be opened for syncing on Windows
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	defer d.Close()
+
+	return d.Sync()
+}
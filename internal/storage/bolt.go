@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"encoding/json"
+	"hson-server/internal/datatree"
+	"hson-server/internal/logger"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var dataBucket = []byte("data")
+
+// Bolt stores every top-level key of the data tree as a JSON document in an embedded bbolt database
+type Bolt struct {
+	Path     string
+	SeedPath string
+
+	db *bolt.DB
+}
+
+// NewBolt opens (or creates) the database at path, seeding it from seedPath when it is empty
+func NewBolt(path, seedPath string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bolt{Path: path, SeedPath: seedPath, db: db}, nil
+}
+
+func (b *Bolt) Load() (map[string]any, error) {
+	data := map[string]any{}
+	empty := true
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(dataBucket)
+
+		if bucket == nil {
+			return nil
+		}
+
+		empty = false
+
+		// Every key in the bucket holds one top-level value of the data tree
+		return bucket.ForEach(func(key, raw []byte) error {
+			var value any
+
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return err
+			}
+
+			data[string(key)] = value
+
+			return nil
+		})
+	})
+
+	if err != nil || !empty {
+		return data, err
+	}
+
+	// First run, import the seed data file into the database
+	seed, err := NewMemory(b.SeedPath).Load()
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Seeding bolt store from data file", "db", b.Path, "seed", b.SeedPath)
+
+	return seed, b.writeKeys(seed, nil)
+}
+
+func (b *Bolt) Save(data map[string]any, op datatree.Operation) error {
+	// Only the top-level key the operation touched needs rewriting
+	if parts := datatree.SplitPath(op.Path); len(parts) > 0 {
+		return b.writeKeys(data, []string{parts[0]})
+	}
+
+	return b.writeKeys(data, nil)
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// writeKeys stores the given top-level keys of data in one transaction, or all of them when keys is nil
+func (b *Bolt) writeKeys(data map[string]any, keys []string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(dataBucket)
+
+		if err != nil {
+			return err
+		}
+
+		// Rewriting everything also drops keys that no longer exist
+		if keys == nil {
+			if err := bucket.ForEach(func(key, _ []byte) error {
+				if _, ok := data[string(key)]; !ok {
+					keys = append(keys, string(key))
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for key := range data {
+				keys = append(keys, key)
+			}
+		}
+
+		for _, key := range keys {
+			value, ok := data[key]
+
+			if !ok {
+				if err := bucket.Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+
+			raw, err := json.Marshal(value)
+
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put([]byte(key), raw); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,490 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hson-server/internal/datatree"
+	"hson-server/internal/hsondoc"
+	"hson-server/internal/logger"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Extensions of the files that become collections in directory mode
+var dirExtensions = []string{".hson", ".hjson", ".json"}
+
+// Dir stores the data tree as a directory where every data file is a top-level key
+// (books.hson => /books) and nested subdirectories map to nested objects
+type Dir struct {
+	Path string
+
+	mu    sync.Mutex
+	files map[string]*dirFile
+}
+
+// dirFile is a single data file of the directory and the tree path it is mounted at
+type dirFile struct {
+	path  string
+	keys  []string
+	doc   *hsondoc.Document
+	hash  [sha256.Size]byte
+	value any
+}
+
+func NewDir(path string) *Dir {
+	return &Dir{Path: filepath.Clean(path), files: map[string]*dirFile{}}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (d *Dir) Load() (map[string]any, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	data := map[string]any{}
+	files := map[string]*dirFile{}
+
+	err := filepath.WalkDir(d.Path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip hidden files and directories, e.g. temp files of in-flight writes
+		if path != d.Path && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.IsDir() || !slices.Contains(dirExtensions, filepath.Ext(path)) {
+			return nil
+		}
+
+		file, err := d.readFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		// Mount the file's value at its path, creating objects for the directories above it
+		if err := mount(data, file.keys, file.value); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		files[path] = file
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.files = files
+
+	return data, nil
+}
+
+// readFile parses a single data file of the directory
+func (d *Dir) readFile(path string) (*dirFile, error) {
+	raw, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := hsondoc.Parse(raw)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &dirFile{
+		path:  path,
+		keys:  d.keysFor(path),
+		doc:   doc,
+		hash:  sha256.Sum256(raw),
+		value: doc.Value(),
+	}, nil
+}
+
+// keysFor maps a file to its tree path e.g: <dir>/api/books.hson => [api, books]
+func (d *Dir) keysFor(path string) []string {
+	rel, _ := filepath.Rel(d.Path, path)
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// dirChange is a file change planned by Save, only applied once every new file is staged
+type dirChange struct {
+	file   *dirFile
+	remove bool
+	isNew  bool
+
+	// New contents of the file and the temp file they were staged in
+	raw   []byte
+	doc   *hsondoc.Document
+	value any
+	tmp   string
+}
+
+// Save rewrites the files an operation touched. Every new file is staged first and only swapped
+// into place once all of them were written, putting back the swapped ones if a swap fails, so the
+// directory never holds half of a change.
+func (d *Dir) Save(data map[string]any, op datatree.Operation) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changes, err := d.plan(data, op)
+
+	if err != nil {
+		return err
+	}
+
+	// Stage the new contents of every file, nothing is visible yet if any of them fails
+	for i := range changes {
+		if changes[i].remove {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(changes[i].file.path), 0o755); err != nil {
+			discardStaged(changes)
+			return err
+		}
+
+		tmp, err := stageFile(changes[i].file.path, changes[i].raw)
+
+		if err != nil {
+			discardStaged(changes)
+			return err
+		}
+
+		changes[i].tmp = tmp
+	}
+
+	// Swap the staged files into place and remove the files of deleted collections
+	for i, change := range changes {
+		if err := change.apply(); err != nil {
+			rollback(changes[:i])
+			discardStaged(changes[i:])
+			return err
+		}
+	}
+
+	// Fsync the directories so the renames and removals survive a crash
+	synced := map[string]bool{}
+
+	for _, change := range changes {
+		if dir := filepath.Dir(change.file.path); !synced[dir] {
+			synced[dir] = true
+
+			if err := syncDir(dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The files now hold the new data, remember it for the next change and the watcher
+	for _, change := range changes {
+		if change.remove {
+			delete(d.files, change.file.path)
+			continue
+		}
+
+		change.file.doc = change.doc
+		change.file.hash = sha256.Sum256(change.raw)
+		change.file.value = datatree.Clone(change.value)
+
+		d.files[change.file.path] = change.file
+	}
+
+	return nil
+}
+
+// plan lists the file changes that bring the directory in line with data after op
+func (d *Dir) plan(data map[string]any, op datatree.Operation) ([]dirChange, error) {
+	opKeys := datatree.SplitPath(op.Path)
+	changes := []dirChange{}
+
+	// Rewrite the existing files the operation could have touched
+	for _, file := range d.files {
+		if !overlaps(file.keys, opKeys) {
+			continue
+		}
+
+		value, err := datatree.Lookup(data, "/"+strings.Join(file.keys, "/"))
+
+		// The collection was removed altogether, so remove its file
+		if err != nil {
+			changes = append(changes, dirChange{file: file, remove: true})
+			continue
+		}
+
+		if reflect.DeepEqual(value, file.value) {
+			continue
+		}
+
+		change, err := encodeChange(file, value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	// New collections get a file of their own
+	return d.planNewFiles(data, nil, changes)
+}
+
+// planNewFiles adds a file for every value under data that no existing file or directory covers
+func (d *Dir) planNewFiles(data map[string]any, prefix []string, changes []dirChange) ([]dirChange, error) {
+	for key, value := range data {
+		keys := append(slices.Clone(prefix), key)
+
+		switch d.coverage(keys) {
+		case coveredByFile:
+			continue
+
+		case coveredByDir:
+			// Descend into directories to find new keys inside them
+			if obj, ok := value.(map[string]any); ok {
+				var err error
+
+				if changes, err = d.planNewFiles(obj, keys, changes); err != nil {
+					return nil, err
+				}
+			}
+
+		default:
+			path := filepath.Join(append([]string{d.Path}, keys...)...) + ".hson"
+			change, err := encodeChange(&dirFile{path: path, keys: keys}, value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			change.isNew = true
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// encodeChange renders the new value of a file
+func encodeChange(file *dirFile, value any) (dirChange, error) {
+	raw, doc, err := encodeDataFile(file.path, file.doc, value)
+
+	if err != nil {
+		return dirChange{}, err
+	}
+
+	return dirChange{file: file, raw: raw, doc: doc, value: value}, nil
+}
+
+// apply swaps the staged file into place, or removes the file
+func (change dirChange) apply() error {
+	if change.remove {
+		return os.Remove(change.file.path)
+	}
+
+	return os.Rename(change.tmp, change.file.path)
+}
+
+// rollback puts back the files of applied changes: new files are removed, the others get the
+// contents they were last loaded or written with
+func rollback(applied []dirChange) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		change := applied[i]
+
+		var err error
+
+		if change.isNew {
+			err = os.Remove(change.file.path)
+		} else {
+			err = writeFileAtomic(change.file.path, change.file.doc.Bytes())
+		}
+
+		if err != nil {
+			logger.Error("Failed to roll back data file, it may hold part of a failed change", "path", change.file.path, "err", err)
+		}
+	}
+}
+
+// discardStaged removes the temp files of changes that were staged but not applied
+func discardStaged(changes []dirChange) {
+	for _, change := range changes {
+		if change.tmp != "" {
+			os.Remove(change.tmp)
+		}
+	}
+}
+
+const (
+	notCovered = iota
+	coveredByFile
+	coveredByDir
+)
+
+// coverage reports whether the tree path is backed by a file, lies above files in a directory, or neither
+func (d *Dir) coverage(keys []string) int {
+	result := notCovered
+
+	for _, file := range d.files {
+		if slices.Equal(file.keys, keys) {
+			return coveredByFile
+		}
+
+		if len(file.keys) > len(keys) && slices.Equal(file.keys[:len(keys)], keys) {
+			result = coveredByDir
+		}
+	}
+
+	return result
+}
+
+func (d *Dir) Close() error {
+	return nil
+}
+
+// WatchDirs lists the directory and its visible subdirectories, new collection files can
+// appear in any of them
+func (d *Dir) WatchDirs() []string {
+	dirs := []string{}
+
+	filepath.WalkDir(d.Path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+
+		if path != d.Path && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		dirs = append(dirs, path)
+
+		return nil
+	})
+
+	return dirs
+}
+
+// Watches reports whether Load would mount the file, the same rules apply to files added later
+func (d *Dir) Watches(path string) bool {
+	rel, err := filepath.Rel(d.Path, filepath.Clean(path))
+
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(name, ".") {
+			return false
+		}
+	}
+
+	return slices.Contains(dirExtensions, filepath.Ext(path))
+}
+
+func (d *Dir) Changed(path string) bool {
+	// Compare under the lock so an in-flight Save has recorded the hashes of what it wrote
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	raw, err := os.ReadFile(path)
+
+	if err != nil {
+		return false
+	}
+
+	file, ok := d.files[path]
+
+	if !ok {
+		return true
+	}
+
+	hash := sha256.Sum256(raw)
+
+	return !bytes.Equal(hash[:], file.hash[:])
+}
+
+// ReloadFile re-reads a single changed file and returns the tree path and value to swap in
+func (d *Dir) ReloadFile(path string) (string, any, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file, err := d.readFile(path)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys, value := file.keys, datatree.Clone(file.value)
+
+	// A file added in a new subdirectory is mounted with the objects above it, e.g: api/meta.hson => /api
+	for i := 1; i < len(file.keys); i++ {
+		if d.coverage(file.keys[:i]) != notCovered {
+			continue
+		}
+
+		keys = file.keys[:i]
+
+		for j := len(file.keys) - 1; j >= i; j-- {
+			value = map[string]any{file.keys[j]: value}
+		}
+
+		break
+	}
+
+	d.files[path] = file
+
+	return "/" + strings.Join(keys, "/"), value, nil
+}
+
+// mount sets value at keys inside data, creating intermediate objects
+func mount(data map[string]any, keys []string, value any) error {
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := data[key]
+
+		if !ok {
+			next = map[string]any{}
+			data[key] = next
+		}
+
+		obj, ok := next.(map[string]any)
+
+		if !ok {
+			return fmt.Errorf("%q is both a file and a directory", key)
+		}
+
+		data = obj
+	}
+
+	last := keys[len(keys)-1]
+
+	if _, exists := data[last]; exists {
+		return fmt.Errorf("%q is defined more than once", last)
+	}
+
+	data[last] = datatree.Clone(value)
+
+	return nil
+}
+
+// overlaps reports whether one path is a prefix of the other
+func overlaps(a, b []string) bool {
+	n := min(len(a), len(b))
+	return slices.Equal(a[:n], b[:n])
+}
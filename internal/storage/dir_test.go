@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"hson-server/internal/datatree"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// TestDirSaveRollsBack fails the second file of a change and expects the first one to be put back
+func TestDirSaveRollsBack(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	seedDir(t, dir)
+
+	// A directory in the way of the new file makes swapping it into place fail
+	if err := os.MkdirAll(filepath.Join(dir, "data", "extra.hson", ".keep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewDir(filepath.Join(dir, "data"))
+	data := load(t, backend)
+
+	before, err := os.ReadFile(filepath.Join(dir, "data", "books.hson"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := datatree.Operation{Verb: datatree.OpSet, Path: "/", Value: map[string]any{
+		"books": []any{map[string]any{"id": float64(1), "title": "Z"}},
+		"meta":  map[string]any{"v": float64(1)},
+		"tags":  []any{"x"},
+		"extra": true,
+	}}
+
+	if err := op.Apply(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Save(data, op); err == nil {
+		t.Fatal("save succeeded with a directory in the way of a new file")
+	}
+
+	after, err := os.ReadFile(filepath.Join(dir, "data", "books.hson"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(after) != string(before) {
+		t.Fatalf("books.hson kept part of the failed change:\n%s", after)
+	}
+
+	// No temp file is left behind and the directory still loads as before
+	if matches, _ := filepath.Glob(filepath.Join(dir, "data", ".*.tmp-*")); len(matches) > 0 {
+		t.Fatalf("temp files left behind: %v", matches)
+	}
+
+	if reloaded := load(t, NewDir(filepath.Join(dir, "data"))); !reflect.DeepEqual(reloaded, seedData()) {
+		t.Fatalf("reloaded %v, want %v", reloaded, seedData())
+	}
+}
+
+// TestDirWatchesNewFiles expects files added after Load to be watched and mounted
+func TestDirWatchesNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "data")
+
+	if err := os.MkdirAll(filepath.Join(root, "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	seedDir(t, dir)
+
+	backend := NewDir(root)
+	load(t, backend)
+
+	path := filepath.Join(root, "api", "authors.hson")
+
+	if err := os.WriteFile(path, []byte("[{id: 1}]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(backend.WatchDirs(), filepath.Join(root, "api")) {
+		t.Fatalf("subdirectory is not watched: %v", backend.WatchDirs())
+	}
+
+	if !backend.Watches(path) || !backend.Changed(path) {
+		t.Fatal("new file is not picked up")
+	}
+
+	if backend.Watches(filepath.Join(root, ".authors.hson.tmp-1")) {
+		t.Fatal("temp files are watched")
+	}
+
+	treePath, value, err := backend.ReloadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"authors": []any{map[string]any{"id": float64(1)}}}
+
+	if treePath != "/api" || !reflect.DeepEqual(value, want) {
+		t.Fatalf("mounted %v at %s, want %v at /api", value, treePath, want)
+	}
+}
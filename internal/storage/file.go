@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hson-server/internal/datatree"
+	"hson-server/internal/hsondoc"
+	"hson-server/internal/logger"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/hjson/hjson-go"
+)
+
+// File stores the data tree in a single HJSON file, keeping its comments and key order intact
+type File struct {
+	Path string
+
+	// Journal mode appends each mutation to a journal instead of rewriting the data file,
+	// compacting it back into the data file every CompactEvery operations and on close
+	Journal      bool
+	CompactEvery int
+
+	mu sync.Mutex
+
+	// Parsed data file, used to keep comments and key order intact when persisting
+	doc *hsondoc.Document
+
+	// Checksum of the file contents we last loaded or persisted, used to ignore our own writes:
+	// persist updates it under mu, so a watcher comparing under mu always sees the latest write
+	fileHash [sha256.Size]byte
+
+	// Latest data tree and number of operations in the journal not yet compacted into the file
+	data           map[string]any
+	journalEntries int
+}
+
+func NewFile(path string, journal bool, compactEvery int) *File {
+	return &File{Path: path, Journal: journal, CompactEvery: compactEvery}
+}
+
+func (f *File) Load() (map[string]any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Get raw data from the hson / data file
+	raw, err := os.ReadFile(f.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, doc, err := parseDataFile(f.Path, raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fileHash := sha256.Sum256(raw)
+
+	// Replay any operations journaled since the data file was last written
+	replayed, edited, err := f.replayJournal(data, fileHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed > 0 {
+		logger.Info("Replayed journal entries", "journal", f.journalPath(), "entries", replayed)
+	}
+
+	// Remember which file contents the in-memory data came from
+	f.doc = doc
+	f.fileHash = fileHash
+	f.data = data
+	f.journalEntries = replayed
+
+	// Without journal mode, fold a leftover journal straight back into the data file. So does
+	// an edited data file, so the journal restarts from the file that now holds everything.
+	if !f.Journal || edited {
+		if err := f.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (f *File) Save(data map[string]any, op datatree.Operation) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Persist updated data back to data file / disk
+	if !f.Journal {
+		return f.persist(data)
+	}
+
+	// In journal mode only the operation is recorded, the data file is compacted later
+	if err := f.appendJournal(op); err != nil {
+		return err
+	}
+
+	f.data = data
+	f.journalEntries++
+
+	// Compaction failures are not fatal, the operations stay safe in the journal
+	if f.CompactEvery > 0 && f.journalEntries >= f.CompactEvery {
+		if err := f.compact(); err != nil {
+			logger.Error("failed to compact journal", "journal", f.journalPath(), "err", err)
+		}
+	}
+
+	return nil
+}
+
+// Close compacts any journaled operations back into the data file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.compact()
+}
+
+func (f *File) WatchDirs() []string {
+	return []string{filepath.Dir(f.Path)}
+}
+
+func (f *File) Watches(path string) bool {
+	return filepath.Clean(path) == filepath.Clean(f.Path)
+}
+
+func (f *File) Changed(path string) bool {
+	// Compare under the lock so an in-flight persist() has recorded the hash of what it wrote
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	raw, err := os.ReadFile(path)
+
+	if err != nil {
+		return false
+	}
+
+	hash := sha256.Sum256(raw)
+
+	return !bytes.Equal(hash[:], f.fileHash[:])
+}
+
+func (f *File) persist(data map[string]any) error {
+	// Convert app data to HJSON encoded data, only touching the bytes of changed values
+	hsonBytes, doc, err := encodeDataFile(f.Path, f.doc, data)
+
+	if err != nil {
+		return err
+	}
+
+	return f.writeDataFile(hsonBytes, doc, data)
+}
+
+// writeDataFile replaces the data file with hsonBytes, the encoding of data
+func (f *File) writeDataFile(hsonBytes []byte, doc *hsondoc.Document, data map[string]any) error {
+	// Atomically replace the data file with the encoded data
+	if err := writeFileAtomic(f.Path, hsonBytes); err != nil {
+		return err
+	}
+
+	// Remember what we wrote so the live-reload watcher can ignore it
+	f.fileHash = sha256.Sum256(hsonBytes)
+	f.doc = doc
+	f.data = data
+
+	return nil
+}
+
+// parseDataFile parses raw HJSON into a document and a separate copy of its data,
+// so the document's own values never change when the data tree is mutated
+func parseDataFile(path string, raw []byte) (map[string]any, *hsondoc.Document, error) {
+	doc, err := hsondoc.Parse(raw)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The root of the data file must be an object
+	data, ok := datatree.Clone(doc.Value()).(map[string]any)
+
+	if !ok {
+		return nil, nil, fmt.Errorf("root of %q must be an object", filepath.Base(path))
+	}
+
+	return data, doc, nil
+}
+
+// encodeDataFile renders data through the parsed document so comments and key order survive,
+// falling back to a plain HJSON encoding if the document can't represent the change
+func encodeDataFile(path string, doc *hsondoc.Document, data any) ([]byte, *hsondoc.Document, error) {
+	if doc != nil {
+		if hsonBytes, err := doc.Update(data); err == nil {
+			// Only trust the preserved output if it parses back to exactly the same data
+			if next, err := hsondoc.Parse(hsonBytes); err == nil && reflect.DeepEqual(next.Value(), data) {
+				return hsonBytes, next, nil
+			}
+		}
+
+		logger.Warn("Could not preserve formatting of data file, rewriting it", "path", path)
+	}
+
+	hsonBytes, err := hjson.Marshal(data)
+
+	// Keep plain JSON files valid JSON
+	if filepath.Ext(path) == ".json" {
+		hsonBytes, err = json.MarshalIndent(data, "", "  ")
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next, err := hsondoc.Parse(hsonBytes)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return hsonBytes, next, nil
+}
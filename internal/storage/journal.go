@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hson-server/internal/datatree"
+	"hson-server/internal/logger"
+	"os"
+)
+
+// journalHeader is the first line of a journal, tying it to the data file it applies to
+type journalHeader struct {
+	Base string `json:"base"`
+}
+
+// journalMarker is the last line of a journal being compacted, holding the checksum of the data
+// file that contains all of its operations
+type journalMarker struct {
+	Compacted string `json:"compacted"`
+}
+
+func (f *File) journalPath() string {
+	return f.Path + ".journal"
+}
+
+// appendJournal durably records an operation, starting a new journal if none exists yet
+func (f *File) appendJournal(op datatree.Operation) error {
+	line, err := json.Marshal(op)
+
+	if err != nil {
+		return err
+	}
+
+	return f.appendJournalLine(line)
+}
+
+// appendJournalLine durably appends a line to the journal, starting it with a header if it is new
+func (f *File) appendJournalLine(line []byte) error {
+	file, err := os.OpenFile(f.journalPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	// A fresh journal starts with the checksum of the data file it builds on
+	if info.Size() == 0 {
+		header, _ := json.Marshal(journalHeader{Base: hex.EncodeToString(f.fileHash[:])})
+		line = append(append(header, '\n'), line...)
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	// The line only counts as persisted once it is on stable storage
+	return file.Sync()
+}
+
+// replayJournal applies outstanding journal entries on top of freshly loaded data.
+// It returns the number of operations replayed, and whether the journal no longer builds on the
+// data file as it is (edited outside the server, or partly compacted), in which case the replayed
+// data should be compacted right away.
+func (f *File) replayJournal(data map[string]any, fileHash [32]byte) (replayed int, edited bool, err error) {
+	raw, readErr := os.ReadFile(f.journalPath())
+
+	if errors.Is(readErr, os.ErrNotExist) {
+		return 0, false, nil
+	}
+
+	if readErr != nil {
+		return 0, false, readErr
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(raw)+1)
+
+	// An empty journal has nothing to replay
+	if !scanner.Scan() {
+		return 0, false, nil
+	}
+
+	var header journalHeader
+
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return 0, false, fmt.Errorf("corrupt journal header in %q: %w", f.journalPath(), err)
+	}
+
+	fileChecksum := hex.EncodeToString(fileHash[:])
+
+	// Read the operations, noting where a compaction marker says the data file already holds them
+	var ops []datatree.Operation
+	compactedUpTo := -1
+
+	for scanner.Scan() {
+		var marker journalMarker
+
+		if json.Unmarshal(scanner.Bytes(), &marker) == nil && marker.Compacted != "" {
+			if marker.Compacted == fileChecksum {
+				compactedUpTo = len(ops)
+			}
+			continue
+		}
+
+		var op datatree.Operation
+
+		// A torn final line means we crashed mid-append, that operation never succeeded
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			logger.Warn("Ignoring incomplete journal entry", "journal", f.journalPath(), "entry", len(ops)+1, "err", err)
+			break
+		}
+
+		ops = append(ops, op)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, false, err
+	}
+
+	switch {
+	case compactedUpTo == len(ops):
+		// A compaction was interrupted after writing the file but before clearing the journal
+		logger.Info("Journal was already compacted into the data file, clearing it", "journal", f.journalPath())
+		return 0, false, os.Remove(f.journalPath())
+
+	case compactedUpTo >= 0:
+		// Only the operations after the compaction are missing from the file
+		ops, edited = ops[compactedUpTo:], true
+
+	case header.Base != fileChecksum:
+		// The data file was edited outside the server since the journal started. The operations
+		// were acknowledged, so they are replayed onto the edited file rather than dropped, and
+		// the journal is kept if they no longer apply.
+		logger.Warn("Data file changed since the journal started, replaying the journal onto it", "journal", f.journalPath())
+		edited = true
+	}
+
+	for _, op := range ops {
+		if err := op.Apply(data); err != nil {
+			return replayed, edited, fmt.Errorf("replaying journal entry %d (%s %s), the journal was kept: %w", replayed+1, op.Verb, op.Path, err)
+		}
+
+		replayed++
+	}
+
+	return replayed, edited, nil
+}
+
+// compact writes the latest data back to the data file and clears the journal
+func (f *File) compact() error {
+	if f.journalEntries == 0 {
+		return nil
+	}
+
+	hsonBytes, doc, err := encodeDataFile(f.Path, f.doc, f.data)
+
+	if err != nil {
+		return err
+	}
+
+	// Mark the journal as folded into exactly these file contents, so a crash between writing the
+	// file and clearing the journal doesn't replay the operations twice
+	hash := sha256.Sum256(hsonBytes)
+	marker, _ := json.Marshal(journalMarker{Compacted: hex.EncodeToString(hash[:])})
+
+	if err := f.appendJournalLine(marker); err != nil {
+		return err
+	}
+
+	// Rewrite the data file first, the journal is only cleared once that succeeded
+	if err := f.writeDataFile(hsonBytes, doc, f.data); err != nil {
+		return err
+	}
+
+	if err := os.Remove(f.journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	logger.Info("Compacted journal into data file", "path", f.Path, "entries", f.journalEntries)
+
+	f.journalEntries = 0
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hson-server/internal/datatree"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// journaledFile creates a data file with seed contents and opens it in journal mode without
+// automatic compaction
+func journaledFile(t *testing.T, seed string) *File {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "data.hson")
+
+	if err := os.WriteFile(path, []byte(seed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewFile(path, true, 0)
+}
+
+// loadAndSave loads the file, applies op to the data and saves it, as the app would
+func loadAndSave(t *testing.T, file *File, op datatree.Operation) {
+	t.Helper()
+
+	data, err := file.Load()
+
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if err := op.Apply(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := file.Save(data, op); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+}
+
+func TestJournalSurvivesExternalEdit(t *testing.T) {
+	file := journaledFile(t, "{\n  books: []\n  meta: {v: 1}\n}\n")
+
+	loadAndSave(t, file, datatree.Operation{Verb: datatree.OpSet, Path: "/books", Value: []any{"Dune"}})
+
+	// Edit the data file outside the server while the write is only in the journal
+	raw, _ := os.ReadFile(file.Path)
+
+	if err := os.WriteFile(file.Path, []byte(strings.Replace(string(raw), "v: 1", "v: 2", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := file.Load()
+
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	want := map[string]any{"books": []any{"Dune"}, "meta": map[string]any{"v": float64(2)}}
+
+	if !reflect.DeepEqual(reloaded, want) {
+		t.Fatalf("reloaded data = %v, want %v", reloaded, want)
+	}
+
+	// The merged data is compacted right away, so it survives the next start too
+	if _, err := os.Stat(file.journalPath()); !os.IsNotExist(err) {
+		t.Fatalf("journal should be compacted after replaying onto an edited file, stat err = %v", err)
+	}
+
+	restarted, err := NewFile(file.Path, true, 0).Load()
+
+	if err != nil || !reflect.DeepEqual(restarted, want) {
+		t.Fatalf("restarted data = %v (err %v), want %v", restarted, err, want)
+	}
+}
+
+func TestJournalKeptWhenReplayFails(t *testing.T) {
+	file := journaledFile(t, "{\n  meta: {v: 1}\n}\n")
+
+	loadAndSave(t, file, datatree.Operation{Verb: datatree.OpSet, Path: "/meta/v", Value: float64(2)})
+
+	// Turn the object into something the journaled write can't apply to
+	if err := os.WriteFile(file.Path, []byte("{\n  meta: 5\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Load(); err == nil {
+		t.Fatal("load should fail when the journal no longer applies")
+	}
+
+	if _, err := os.Stat(file.journalPath()); err != nil {
+		t.Fatalf("journal with acknowledged operations must be kept: %v", err)
+	}
+}
+
+func TestJournalInterruptedCompaction(t *testing.T) {
+	file := journaledFile(t, "{\n  books: [\"A\", \"B\"]\n}\n")
+
+	// Deleting by index is not idempotent, so replaying it twice would show
+	loadAndSave(t, file, datatree.Operation{Verb: datatree.OpDelete, Path: "/books/0"})
+
+	// Compact, then put the journal back as if the process died before clearing it
+	journal, _ := os.ReadFile(file.journalPath())
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if _, err := os.Stat(file.journalPath()); !os.IsNotExist(err) {
+		t.Fatal("journal should be cleared by the compaction")
+	}
+
+	compacted, _ := os.ReadFile(file.Path)
+	marker := `{"compacted":"` + checksum(compacted) + `"}` + "\n"
+
+	if err := os.WriteFile(file.journalPath(), append(journal, marker...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFile(file.Path, true, 0).Load()
+
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if want := map[string]any{"books": []any{"B"}}; !reflect.DeepEqual(reloaded, want) {
+		t.Fatalf("operations were replayed twice: %v, want %v", reloaded, want)
+	}
+}
+
+func checksum(raw []byte) string {
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:])
+}
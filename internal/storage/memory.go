@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"hson-server/internal/datatree"
+	"os"
+)
+
+// Memory keeps the data tree in memory only, seeded from a data file that is never written to
+type Memory struct {
+	SeedPath string
+}
+
+func NewMemory(seedPath string) *Memory {
+	return &Memory{SeedPath: seedPath}
+}
+
+func (m *Memory) Load() (map[string]any, error) {
+	// Start from an empty tree when there is no seed file
+	if m.SeedPath == "" {
+		return map[string]any{}, nil
+	}
+
+	// A directory seed is read the same way directory mode reads it
+	if isDir(m.SeedPath) {
+		return NewDir(m.SeedPath).Load()
+	}
+
+	raw, err := os.ReadFile(m.SeedPath)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]any{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, _, err := parseDataFile(m.SeedPath, raw)
+
+	return data, err
+}
+
+// Save is a no-op, changes only live as long as the process
+func (m *Memory) Save(data map[string]any, op datatree.Operation) error {
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
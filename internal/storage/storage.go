@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"hson-server/internal/datatree"
+)
+
+// Backend persists the data tree of the app.
+// Implementations don't need to be safe for concurrent Saves, the app serializes mutations.
+type Backend interface {
+	// Load returns the stored data tree
+	Load() (map[string]any, error)
+
+	// Save durably records an operation that turned the data tree into data
+	Save(data map[string]any, op datatree.Operation) error
+
+	// Close flushes anything pending and releases the backend's resources
+	Close() error
+}
+
+// Watcher is implemented by backends whose data lives in files that can be edited externally
+type Watcher interface {
+	// WatchDirs lists the directories holding the data files, read again as files get added
+	WatchDirs() []string
+
+	// Watches reports whether a file in those directories holds data, including files created
+	// after the backend was loaded
+	Watches(path string) bool
+
+	// Changed reports whether a file differs from what the backend last loaded or wrote
+	Changed(path string) bool
+}
+
+// FileReloader is implemented by watchers that can reload a single changed file
+// instead of the whole data tree
+type FileReloader interface {
+	// ReloadFile returns the tree path the file is mounted at and its new value
+	ReloadFile(path string) (string, any, error)
+}
+
+// Options configures the backend created by New
+type Options struct {
+	// Journal and CompactEvery enable journal mode for the file backend
+	Journal      bool
+	CompactEvery int
+}
+
+const (
+	KindFile   = "file"
+	KindMemory = "memory"
+	KindBolt   = "bolt"
+)
+
+// New creates the backend of the given kind for the data file (or directory) at path
+func New(kind, path string, opts Options) (Backend, error) {
+	switch kind {
+	case KindFile, "":
+		// Directory mode, one file per top-level collection
+		if isDir(path) {
+			if opts.Journal {
+				return nil, fmt.Errorf("journal mode is not supported for a data directory")
+			}
+			return NewDir(path), nil
+		}
+		return NewFile(path, opts.Journal, opts.CompactEvery), nil
+	case KindMemory:
+		return NewMemory(path), nil
+	case KindBolt:
+		return NewBolt(path+".bolt", path)
+	default:
+		return nil, fmt.Errorf("unknown store %q (expected %s, %s or %s)", kind, KindFile, KindMemory, KindBolt)
+	}
+}
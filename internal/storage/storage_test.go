@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"hson-server/internal/datatree"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	seedBooks = "[\n  {id: 1, title: \"A\"} // the first book\n]\n"
+	seedMeta  = "{v: 1}\n"
+	seedTags  = "[\"x\"]\n"
+)
+
+// backendCase opens a backend over the seed data in dir. Reopening it after Close (or after a
+// simulated crash) must see every saved change, unless the backend keeps changes in memory only.
+type backendCase struct {
+	name       string
+	seed       func(t *testing.T, dir string)
+	open       func(t *testing.T, dir string) Backend
+	persistent bool
+
+	// crash releases what a killed process would release, without flushing anything
+	crash func(backend Backend)
+}
+
+func seedFile(t *testing.T, dir string) {
+	t.Helper()
+
+	seed := "{\n  books: " + seedBooks + "  meta: " + seedMeta + "  tags: " + seedTags + "}\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "data.hson"), []byte(seed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func seedDir(t *testing.T, dir string) {
+	t.Helper()
+
+	for name, contents := range map[string]string{"books.hson": seedBooks, "meta.hson": seedMeta, "tags.hson": seedTags} {
+		if err := os.WriteFile(filepath.Join(dir, "data", name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var backendCases = []backendCase{
+	{
+		name:       "file",
+		seed:       seedFile,
+		open:       func(t *testing.T, dir string) Backend { return NewFile(filepath.Join(dir, "data.hson"), false, 0) },
+		persistent: true,
+	},
+	{
+		name:       "file journal",
+		seed:       seedFile,
+		open:       func(t *testing.T, dir string) Backend { return NewFile(filepath.Join(dir, "data.hson"), true, 0) },
+		persistent: true,
+	},
+	{
+		name:       "file journal compacting",
+		seed:       seedFile,
+		open:       func(t *testing.T, dir string) Backend { return NewFile(filepath.Join(dir, "data.hson"), true, 2) },
+		persistent: true,
+	},
+	{
+		name: "dir",
+		seed: func(t *testing.T, dir string) {
+			if err := os.Mkdir(filepath.Join(dir, "data"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			seedDir(t, dir)
+		},
+		open:       func(t *testing.T, dir string) Backend { return NewDir(filepath.Join(dir, "data")) },
+		persistent: true,
+	},
+	{
+		name:       "memory",
+		seed:       seedFile,
+		open:       func(t *testing.T, dir string) Backend { return NewMemory(filepath.Join(dir, "data.hson")) },
+		persistent: false,
+	},
+	{
+		name: "bolt",
+		seed: seedFile,
+		open: func(t *testing.T, dir string) Backend {
+			backend, err := NewBolt(filepath.Join(dir, "data.hson.bolt"), filepath.Join(dir, "data.hson"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return backend
+		},
+		persistent: true,
+
+		// The database file lock dies with the process, the committed transactions stay
+		crash: func(backend Backend) { backend.(*Bolt).db.Close() },
+	},
+}
+
+func seedData() map[string]any {
+	return map[string]any{
+		"books": []any{map[string]any{"id": float64(1), "title": "A"}},
+		"meta":  map[string]any{"v": float64(1)},
+		"tags":  []any{"x"},
+	}
+}
+
+// conformanceOps covers replacing a value, appending with a generated id, deleting a key and
+// creating a new top-level key
+func conformanceOps() []datatree.Operation {
+	return []datatree.Operation{
+		{Verb: datatree.OpAppend, Path: "/books", Value: map[string]any{"title": "B"}},
+		{Verb: datatree.OpSet, Path: "/tags", Value: []any{"x", "y"}},
+		{Verb: datatree.OpDelete, Path: "/meta"},
+		{Verb: datatree.OpSet, Path: "/extra", Value: map[string]any{"on": true}},
+	}
+}
+
+func changedData() map[string]any {
+	return map[string]any{
+		"books": []any{
+			map[string]any{"id": float64(1), "title": "A"},
+			map[string]any{"id": float64(2), "title": "B"},
+		},
+		"tags":  []any{"x", "y"},
+		"extra": map[string]any{"on": true},
+	}
+}
+
+// saveAll applies every operation to data and saves it, as the app does for each mutation
+func saveAll(t *testing.T, backend Backend, data map[string]any) {
+	t.Helper()
+
+	for _, op := range conformanceOps() {
+		if err := op.Apply(data); err != nil {
+			t.Fatalf("apply %s %s: %v", op.Verb, op.Path, err)
+		}
+
+		if err := backend.Save(data, op); err != nil {
+			t.Fatalf("save %s %s: %v", op.Verb, op.Path, err)
+		}
+	}
+}
+
+func load(t *testing.T, backend Backend) map[string]any {
+	t.Helper()
+
+	data, err := backend.Load()
+
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	return data
+}
+
+func TestBackendConformance(t *testing.T) {
+	for _, tc := range backendCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("load", func(t *testing.T) {
+				dir := t.TempDir()
+				tc.seed(t, dir)
+
+				backend := tc.open(t, dir)
+				defer backend.Close()
+
+				if data := load(t, backend); !reflect.DeepEqual(data, seedData()) {
+					t.Fatalf("loaded %v, want %v", data, seedData())
+				}
+			})
+
+			t.Run("save, close and reopen", func(t *testing.T) {
+				dir := t.TempDir()
+				tc.seed(t, dir)
+
+				backend := tc.open(t, dir)
+				data := load(t, backend)
+
+				saveAll(t, backend, data)
+
+				if err := backend.Close(); err != nil {
+					t.Fatalf("close: %v", err)
+				}
+
+				want := changedData()
+
+				if !tc.persistent {
+					want = seedData()
+				}
+
+				reopened := tc.open(t, dir)
+				defer reopened.Close()
+
+				if data := load(t, reopened); !reflect.DeepEqual(data, want) {
+					t.Fatalf("reopened %v, want %v", data, want)
+				}
+			})
+
+			t.Run("reopen after crash", func(t *testing.T) {
+				if !tc.persistent {
+					t.Skip("changes are kept in memory only")
+				}
+
+				dir := t.TempDir()
+				tc.seed(t, dir)
+
+				backend := tc.open(t, dir)
+				saveAll(t, backend, load(t, backend))
+
+				// Every acknowledged save must survive without Close, e.g. replayed from the journal
+				if tc.crash != nil {
+					tc.crash(backend)
+				}
+
+				reopened := tc.open(t, dir)
+				defer reopened.Close()
+
+				if data := load(t, reopened); !reflect.DeepEqual(data, changedData()) {
+					t.Fatalf("reopened %v, want %v", data, changedData())
+				}
+			})
+		})
+	}
+}
+
+func TestFileKeepsComments(t *testing.T) {
+	dir := t.TempDir()
+	seedFile(t, dir)
+
+	backend := NewFile(filepath.Join(dir, "data.hson"), false, 0)
+	saveAll(t, backend, load(t, backend))
+
+	raw, err := os.ReadFile(backend.Path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(raw), "// the first book") {
+		t.Fatalf("comment was dropped from the data file:\n%s", raw)
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import "errors"
+
+// ErrPersist is wrapped around any failure to write the data tree back to disk
+var ErrPersist = errors.New("failed to persist data file")
+
+// ErrPrecondition is returned when a conditional request (If-Match) no longer matches the resource
+var ErrPrecondition = errors.New("resource has changed, precondition failed")
+
+// ErrNothingToUndo is returned by undo when the change history is empty
+var ErrNothingToUndo = errors.New("no change to undo")
+
+// ErrNothingToRedo is returned by redo when no change was undone since the last write
+var ErrNothingToRedo = errors.New("no undone change to redo")
+
+// ErrSnapshotNotFound is returned when restoring or deleting a named snapshot that was never saved
+var ErrSnapshotNotFound = errors.New("snapshot not found")
@@ -5,13 +5,15 @@ import (
 	"flag"
 	"fmt"
 	"hson-server/internal/app"
+	"hson-server/internal/datatree"
 	"hson-server/internal/logger"
 	"hson-server/internal/router"
+	"hson-server/internal/schema"
+	"hson-server/internal/storage"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"sync/atomic"
 	"syscall"
 
 	"github.com/fsnotify/fsnotify"
@@ -22,7 +24,7 @@ func main() {
 	logger.Setup()
 
 	// Parse command-line flags to get the HSON file path, server port to listen on, and live-reloading option
-	dbPath, serverPort, liveReload := parseAppFlags()
+	dbPath, serverPort, storeKind, schemaPath, liveReload, journal, compactEvery := parseAppFlags()
 
 	// Resolve the db file path to an absolute path
 	resolvedPath, err := resolveDataFile(dbPath)
@@ -34,21 +36,42 @@ func main() {
 	// Update the dbPath to the updated absolute path
 	dbPath = resolvedPath
 
+	// Init the storage backend that persists the data tree
+	backend, err := storage.New(storeKind, dbPath, storage.Options{Journal: journal, CompactEvery: compactEvery})
+
+	if err != nil {
+		logger.Fatal("Failed to open the storage backend", "store", storeKind, "path", dbPath, "err", err)
+	}
+
 	// Init the app struct
 	app := &app.App{
-		Data:     map[string]any{},
-		FilePath: dbPath,
+		Backend: backend,
 	}
 
-	// Load data from the HSON file into memory / app.Data
+	// Load the JSON Schemas writes are validated against, if any were given
+	if schemaPath != "" {
+		schemas, err := schema.LoadFile(schemaPath)
+
+		if err != nil {
+			logger.Fatal("Failed to load the schema file", "path", schemaPath, "err", err)
+		}
+
+		app.Schemas = schemas
+	}
+
+	// Load data from the storage backend into memory as the first snapshot
 	if err := app.LoadDataFromFile(); err != nil {
-		logger.Fatal("Failed to access the database file", "path", dbPath, "err", err)
+		logger.Fatal("Failed to access the database file", "path", dbPath, "store", storeKind, "err", err)
 	}
 
 	// Only watch HSON / data file for updates if live reload was requested
 	if liveReload {
-		go watchHSONFile(app)
-		logger.Info("Live‐reload enabled: watching", "file", dbPath)
+		if watched, ok := backend.(storage.Watcher); ok {
+			go watchHSONFile(app, watched)
+			logger.Info("Live‐reload enabled: watching", "file", dbPath)
+		} else {
+			logger.Warn("Live-reload is not supported by this store, ignoring", "store", storeKind)
+		}
 	}
 
 	// Init HTTP router / handler that handles incoming requests and dispatches actions based on HTTP verb
@@ -62,7 +85,7 @@ func main() {
 
 	// Start the HTTP server in a background goroutine so can handle shutdown signals below
 	go func() {
-		logger.Info("Starting HSON Server", "port", serverPort, "data file", dbPath)
+		logger.Info("Starting HSON Server", "port", serverPort, "data file", dbPath, "store", storeKind)
 
 		// Start serving HTTP requests
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -84,21 +107,39 @@ func main() {
 	// Attempt graceful shutdown
 	if err := server.Shutdown(context.Background()); err != nil {
 		logger.Error("Graceful shutdown failed, forcing exit", "err", err)
-	} else {
-		logger.Info("🌙  HSON Server shutdown complete. See you next time!")
 	}
+
+	// Flush the storage backend, e.g. fold journaled operations back into the data file
+	if err := app.Close(); err != nil {
+		logger.Error("Failed to close the storage backend cleanly", "store", storeKind, "err", err)
+	}
+
+	logger.Info("🌙  HSON Server shutdown complete. See you next time!")
 }
 
-func parseAppFlags() (dbPath, serverPort string, liveReload bool) {
+func parseAppFlags() (dbPath, serverPort, storeKind, schemaPath string, liveReload, journal bool, compactEvery int) {
 	// Register cli flags for configuring server e.g: port, hson file path, live-reloading, etc...
-	flag.StringVar(&dbPath, "db", "data.hson", "path to your HSON database file")
+	flag.StringVar(&dbPath, "db", "data.hson", "path to your HSON database file, or a directory with one file per collection")
 	flag.StringVar(&dbPath, "database", "data.hson", "alias for --db")
 	flag.StringVar(&serverPort, "port", "3000", "port the server will listen on")
+	flag.StringVar(&storeKind, "store", storage.KindFile, "storage backend: file (HSON file), memory (never writes to disk) or bolt (embedded database at <db>.bolt)")
+	flag.StringVar(&schemaPath, "schema", "", "path to an HSON/JSON file mapping collection paths to JSON Schemas that writes must satisfy")
 	flag.BoolVar(&liveReload, "live-reload", false, "watch HSON file and reload on external changes")
+	flag.BoolVar(&journal, "journal", false, "append mutations to a journal instead of rewriting the HSON file on every write")
+	flag.IntVar(&compactEvery, "compact-every", 100, "compact the journal into the HSON file after this many mutations (0 = only on shutdown)")
 
 	// Register cli flags for logger e.g: log level, verbose option
 	logger.RegisterFlags()
 
+	// Register cli flags for the data tree e.g: id strategy
+	datatree.RegisterFlags()
+
+	// Register cli flags for HTTP responses e.g: envelope mode
+	router.RegisterFlags()
+
+	// Register cli flags for the app e.g: history depth
+	app.RegisterFlags()
+
 	// Parse all registered command-line flags
 	flag.Parse()
 
@@ -134,7 +175,7 @@ func resolveDataFile(dbPath string) (string, error) {
 	return "", fmt.Errorf("No data.hson found in cwd or executable directory. Please specify a path to your HSON file using the --db or --database flag.")
 }
 
-func watchHSONFile(app *app.App) {
+func watchHSONFile(app *app.App, store storage.Watcher) {
 	// Init the live reload watcher
 	watcher, err := fsnotify.NewWatcher()
 
@@ -145,23 +186,36 @@ func watchHSONFile(app *app.App) {
 
 	defer watcher.Close()
 
-	// Start monitoring file path using watcher
-	if err := watcher.Add(app.FilePath); err != nil {
-		logger.Error("Watcher.Add failed", "path", app.FilePath, "err", err)
+	// Watch the parent directories since persisting renames a new file over the old one,
+	// which would otherwise drop a watch placed on the file itself. It also catches new files.
+	if err := watchDirs(watcher, store); err != nil {
+		logger.Error("Watcher.Add failed", "err", err)
 		return
 	}
 
 	// Loop through the watcher events indefintely
 	for ev := range watcher.Events {
-		// Only monitor write events and ensure update did not come from code / app.Persist() call
-		if ev.Op&fsnotify.Write == 0 || atomic.LoadUint32(&app.SelfWriting) == 1 {
+		// A new subdirectory may hold collection files too, so watch it as well
+		if ev.Op&fsnotify.Create != 0 && isDir(ev.Name) {
+			if err := watchDirs(watcher, store); err != nil {
+				logger.Error("Watcher.Add failed", "err", err)
+			}
+		}
+
+		// Only monitor write / create events on the data files themselves
+		if !store.Watches(ev.Name) || ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+			continue
+		}
+
+		// Ensure update did not come from code / the backend persisting a change
+		if !store.Changed(ev.Name) {
 			continue
 		}
 
-		logger.Info("Reloading HSON from disk")
+		logger.Info("Reloading HSON from disk", "file", ev.Name)
 
-		// Load data from HSON file to app memory
-		if err := app.LoadDataFromFile(); err != nil {
+		// Load data from the changed HSON file to app memory
+		if err := app.ReloadFile(ev.Name); err != nil {
 			logger.Error("Reload failed", "err", err)
 		}
 	}
@@ -170,3 +224,19 @@ func watchHSONFile(app *app.App) {
 		logger.Error("Watcher error", "err", err)
 	}
 }
+
+// watchDirs adds every directory of the store to the watcher, directories already watched are kept as is
+func watchDirs(watcher *fsnotify.Watcher, store storage.Watcher) error {
+	for _, dir := range store.WatchDirs() {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+
+	return nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}